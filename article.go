@@ -27,31 +27,47 @@ import (
 	"strings"
 	"time"
 
-	"github.com/russross/blackfriday"
+	"gopkg.in/yaml.v2"
 )
 
 type Article struct {
 	Id          string
+	File        string
 	Title       string
 	Date        time.Time
 	DateFormat  map[string]string
 	Content     []byte
-	Meta        map[string]string
+	Summary     string // HTML, see summary.go
+	HasMore     bool
+	TOC         string   // HTML, see toc.go
+	Backlinks   Articles // posts linking to this one, see links.go
+	Meta        Meta
 	ArticleTags Tags
+	Draft       bool
+	titleHead   bool   // the title is the first level 1 heading
+	hash        string // hash of the source file, see manifest.go
+	html        string // content rendered by render
+	htmlURL     string
+	links       Articles // posts linked from this one
+	static      bool
+	permalink   string // see permalink.go
+	baseURL     string
+	loc         *time.Location // time zone of the dates without one
 }
 
 var checkID = regexp.MustCompile("[^(\\w|\\.)]")
 
 const (
-	RSSDateFormat  = "Mon, 02 Jan 2006 15:04:05 GMT"
+	RSSDateFormat  = time.RFC1123Z
 	AtomDateFormat = time.RFC3339
 	OrgDateFormat  = "2006-01-02"
 	PostDateFormat = "Mon, 02 Jan 2006"
 )
 
-func NewArticle(id string) (*Article, error) {
+func NewArticle(id string, loc *time.Location) (*Article, error) {
 	a := new(Article)
-	a.Date = time.Now()
+	a.loc = loc
+	a.Date = time.Now().In(loc).Truncate(time.Second)
 	a.DateFormat = make(map[string]string)
 	a.DateFormat["PostDateFormat"] = a.GetDateString(PostDateFormat)
 	a.DateFormat["SitemapDateFormat"] = a.GetDateString(OrgDateFormat)
@@ -59,41 +75,72 @@ func NewArticle(id string) (*Article, error) {
 
 	a.Id = checkID.ReplaceAllString(id, "-")
 
-	a.Meta = make(map[string]string)
+	a.Meta = make(Meta)
 	a.Meta["Id"] = a.Id
-	a.Meta["Date"] = date2String(a.Date)
+	a.Meta["Date"] = a.Date
 	a.Meta["Author"] = "Sergio de Mingo"
-	a.Meta["Tags"] = ""
+	a.Meta["Tags"] = []string{}
 
 	return a, nil
 }
 
-func ParseArticle(ifile string) (*Article, error) {
+// ParseArticle reads a source file. Its dates without a time zone are
+// in loc, the Timezone of config.json.
+func ParseArticle(ifile string, loc *time.Location) (*Article, error) {
 	a := new(Article)
+	a.loc = loc
 
 	b, err := ioutil.ReadFile(ifile)
 	if err != nil {
 		return nil, err
 	}
 
-	a.Content = b
-	a.Title = parseTitle(a.Content)
-	a.Meta = make(map[string]string)
-	a.Meta["Id"] = parseProperty(a.Content, "Id")
-	a.Meta["Date"] = parseProperty(a.Content, "Date")
-	a.Meta["Author"] = parseProperty(a.Content, "Author")
-	a.Meta["Tags"] = parseProperty(a.Content, "Tags")
-	a.Date, err = parseDate(a.Meta["Date"])
+	a.File = ifile
+	a.hash = hashOf(ifile, string(b))
+	meta, body, err := parseFrontMatter(b)
+	if err != nil {
+		return nil, err
+	}
+	a.Content = body
+
+	switch {
+	case meta != nil:
+		a.Meta = meta
+		a.Title = meta.String("Title")
+	case isOrgFile(ifile):
+		a.Meta = parseOrgProperties(a.Content)
+	default:
+		a.Meta = parseLegacyProperties(a.Content)
+	}
+	if a.Title == "" {
+		if isOrgFile(ifile) {
+			a.Title = parseOrgTitle(a.Content)
+			a.titleHead = a.Title != "" && !orgTitleReg.Match(a.Content)
+		} else {
+			a.Title = parseTitle(a.Content)
+			a.titleHead = a.Title != ""
+		}
+	}
+	for _, k := range []string{"Id", "Date", "Author", "Tags"} {
+		if !a.Meta.Has(k) {
+			a.Meta[k] = ""
+		}
+	}
+
+	a.Date, err = a.Meta.Time("Date", loc)
 	if err != nil {
 		return nil, errors.New("Article with corrupted date")
 	}
-	a.Id = a.Meta["Id"]
+	a.Date = a.Date.In(loc)
+	a.Id = a.Meta.String("Id")
+	a.Draft = a.Meta.Bool("Draft")
 
-	a.Date, _ = parseDate(a.Meta["Date"])
 	a.DateFormat = make(map[string]string)
 	a.DateFormat["PostDateFormat"] = a.GetDateString(PostDateFormat)
 	a.DateFormat["SitemapDateFormat"] = a.GetDateString(OrgDateFormat)
 	a.DateFormat["RSSDateFormat"] = a.GetDateString(RSSDateFormat)
+	a.DateFormat["AtomDateFormat"] = a.GetDateString(AtomDateFormat)
+	a.DateFormat["AtomUpdatedFormat"] = a.GetUpdated().Format(AtomDateFormat)
 
 	a.ArticleTags = make(Tags)
 
@@ -119,24 +166,72 @@ func (a *Article) GetYear() string {
 }
 
 func (a *Article) GetDate() time.Time {
-	t, _ := parseDate(a.Meta["Date"])
-	return t
+	return a.Date
+}
+
+// GetUpdated returns the date of the last change of the article, from
+// its Updated property, or its date when it has none.
+func (a *Article) GetUpdated() time.Time {
+	t, err := a.Meta.Time("Updated", a.loc)
+	if err != nil || t.Before(a.Date) {
+		return a.Date
+	}
+	return t.In(a.loc)
+}
+
+// GetExpiryDate returns the date when the article stops being
+// published. The boolean is false for articles that never expire.
+func (a *Article) GetExpiryDate() (time.Time, bool) {
+	t, err := a.Meta.Time("ExpiryDate", a.loc)
+	if err != nil {
+		return t, false
+	}
+	return t.In(a.loc), true
+}
+
+// GetTags returns the names of the tags of the article, from a front
+// matter list or from the comma separated legacy property.
+func (a *Article) GetTags() []string {
+	return a.Meta.List("Tags")
 }
 
 func (a *Article) GetDateString(format string) string {
 	return a.Date.Format(format)
 }
 
+// contentHTML renders the article content with the renderer of its
+// source file, see render.go. The content rendered for the build is
+// reused.
+func (a *Article) contentHTML(site *siteSettings, url string) string {
+	if a.html != "" && a.htmlURL == url {
+		return a.html
+	}
+	content, _ := addTOC(site.renderer(a.File).HTML(a.Content, url, a.titleHead), site.tocDepth)
+	return content
+}
+
+// render renders the article once for the build and sets its TOC. It
+// must not be called while the pages are rendered.
+func (a *Article) render(site *siteSettings, url string) {
+	a.html, a.TOC = addTOC(site.renderer(a.File).HTML(a.Content, url, a.titleHead), site.tocDepth)
+	a.htmlURL = url
+}
+
 func (a *Article) WriteNewFile(ofile string) error {
-	s := "# Article Title\n"
-	s = s + "<!---\n"
+	fm := make(map[string]interface{})
+	fm["title"] = "Article Title"
 	for k, v := range a.Meta {
-		s = s + ":" + k + ": " + v + "\n"
+		fm[strings.ToLower(k[:1])+k[1:]] = v
 	}
-	s = s + "-->\n"
+	y, err := yaml.Marshal(fm)
+	if err != nil {
+		return err
+	}
+
+	s := "---\n" + string(y) + "---\n"
 	s = s + "\n\n Write your article!\n\n"
 
-	err := ioutil.WriteFile(ofile, []byte(s), 0644)
+	err = ioutil.WriteFile(ofile, []byte(s), 0644)
 	if err != nil {
 		return err
 	}
@@ -148,29 +243,28 @@ func (a *Article) WriteNewFile(ofile string) error {
    Private Methods
 */
 
-func date2String(date time.Time) string {
-	s := date.Format("<" + OrgDateFormat)
-	s = s + " " + date.Weekday().String()[:3] + ">"
-	return s
-}
-
-func parseDate(orgdate string) (time.Time, error) {
-
-	dayReg := regexp.MustCompile("[a-zA-Z\\>\\< ]+")
-	orgdate = dayReg.ReplaceAllString(orgdate, "")
-	t, err := time.Parse("2006-01-02", orgdate)
-	return t, err
-}
-
-func parseProperty(content []byte, key string) string {
+// parseDate reads the dates of the properties. Besides the formats of
+// metaDateFormats it accepts Org-mode timestamps like
+// <2013-05-16 Thu> or <2013-05-16 Thu 10:30>. Dates without a time
+// zone are in loc.
+func parseDate(orgdate string, loc *time.Location) (time.Time, error) {
+
+	dayReg := regexp.MustCompile("^[a-zA-Z\\.]+$")
+	fields := strings.Fields(strings.Trim(orgdate, "<>[] \t"))
+	date := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if !dayReg.MatchString(f) {
+			date = append(date, f)
+		}
+	}
+	orgdate = strings.Join(date, " ")
 
-	propReg := regexp.MustCompile("(?m)^:" + key + ":.+$")
-	p := string(propReg.Find(content))
-	f := strings.Split(p, ":"+key+":")
-	if (f == nil) || (len(f) < 2) {
-		return ""
+	for _, f := range metaDateFormats {
+		if t, err := time.ParseInLocation(f, orgdate, loc); err == nil {
+			return t, nil
+		}
 	}
-	return strings.Trim(f[1], " \t")
+	return time.Time{}, errors.New("Bad date " + orgdate)
 }
 
 func parseTitle(content []byte) string {
@@ -183,19 +277,3 @@ func parseTitle(content []byte) string {
 	}
 	return strings.Trim(f[1], " \t")
 }
-
-func Markdown2HTML(content []byte, url string) string {
-
-	var head1Reg = regexp.MustCompile(`(?m)^\# .+\n`)
-	var linkReg = regexp.MustCompile(`\[(?P<text>[^\]]+)]\((?P<url>[^\)]+)\)`)
-	var imgReg = regexp.MustCompile(`!\[img\]\(\.\./img/(?P<src>[^\)]+)\)`)
-
-	// var imgLinkReg = regexp.MustCompile("\\[\\[file:\\.\\./img/(?P<img>[^\\]]+)\\]\\[file:\\.\\./img/(?P<thumb>[^\\]]+)\\]\\]")
-
-	content = head1Reg.ReplaceAll(content, []byte(""))
-	content = imgReg.ReplaceAll(content, []byte("<a href='"+url+"/img/$src'><img src='"+url+"/img/thumbs/$src'/></a>"))
-	//content = imgLinkReg.ReplaceAll(content, []byte("<a href='"+url+"/img/$src'><img src='"+url+"/img/thumbs/$thumb'/></a>"))
-	content = linkReg.ReplaceAll(content, []byte("<a href='$url'>$text</a>"))
-
-	return string(blackfriday.MarkdownCommon(content))
-}
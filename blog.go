@@ -28,7 +28,7 @@ import (
 	"image/jpeg"
 	"io"
 	"io/ioutil"
-	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
@@ -58,21 +58,52 @@ type Articles []*Article
 type Blog struct {
 	Dir         string
 	ThemeDir    string
+	PublishDir  string // where the site is generated
 	Info        BlogInfo
 	Posts       Articles
 	Nposts      int
 	Statics     Articles
 	Nstatics    int
-	Years       []bool
+	Archive     []ArchiveYear // posts by date, newest first
 	Months      []string
-	Selected    int
 	BlogTags    Tags //all tags
-	TagSelected Tag
-	DebugServer *WebSockServer
+	Options     BuildOptions
+	Scheduled   Articles // future posts, oldest first
+	Expiring    Articles // published posts with an expiry date
+	now         time.Time
+	manifest    *buildManifest
+	output      siteOutput // PublishDir, unless it is a preview
+	siteKey     string
+	templates   map[string]*template.Template
+	redirects   []redirect // aliases of the articles, see redirect.go
+	loadErrors  buildErrors // sources that could not be parsed
+	site        *siteSettings
+	unpublished Articles    // drafts, future and expired posts not loaded
 }
 
 type BlogInfo map[string]string
 
+// ArchiveYear and ArchiveMonth index the posts by date for the archive
+// page. Only the years and months with posts are indexed.
+type ArchiveYear struct {
+	Year   int
+	Months []ArchiveMonth
+}
+
+type ArchiveMonth struct {
+	Month int
+	Name  string
+	Posts Articles
+}
+
+// BuildOptions selects which sources are loaded and published. The
+// default values are the ones of a production build.
+type BuildOptions struct {
+	Drafts  bool   // load draft posts and statics too
+	Future  bool   // load the posts with a future date too
+	BaseURL string // the Url of the site instead of the one of config.json
+}
+
 func CreateBlog(dir string, themes string) (*Blog, error) {
 
 	b := new(Blog)
@@ -82,10 +113,10 @@ func CreateBlog(dir string, themes string) (*Blog, error) {
 	b.Info["Subtitle"] = "I wanna be Grom!!"
 	b.Info["Theme"] = "default"
 	b.Info["Url"] = "http://yourdomain.com"
+	b.Info["PublishDir"] = "public"
 
-	b.Years = make([]bool, 100)
 	b.Months = months
-	b.Posts = make([]*Article, 500)
+	b.Posts = make(Articles, 0)
 	b.Nposts = 0
 
 	jb, err := json.MarshalIndent(b.Info, " ", " ")
@@ -98,9 +129,7 @@ func CreateBlog(dir string, themes string) (*Blog, error) {
 	os.Mkdir(dir, 0755)
 	os.Mkdir(dir+"static", 0755)
 	os.Mkdir(dir+"post", 0755)
-	os.Mkdir(dir+"html", 0755)
 	os.Mkdir(dir+"img", 0755)
-	os.Mkdir(dir+"img/thumbs", 0755)
 
 	err = createDefaultTheme(dir, themes)
 	if err != nil {
@@ -138,25 +167,95 @@ func createDefaultTheme(bdir string, tdir string) error {
 	return nil
 }
 
-func LoadBlog(dir string) *Blog {
+func LoadBlogInfo(dir string) (BlogInfo, error) {
 
 	jb, err := ioutil.ReadFile(dir + "config.json")
 	if err != nil {
-		fmt.Println(err)
-		return nil
+		return nil, err
 	}
 
 	info := make(BlogInfo)
 	err = json.Unmarshal(jb, &info)
+	return info, err
+}
+
+// siteSettings are the settings of config.json used to parse and
+// render the sources. Every LoadBlog reads them again, so a removed
+// key goes back to its default.
+type siteSettings struct {
+	location  *time.Location // time zone of the dates without one
+	highlight highlightOptions
+	markdown  MarkdownRenderer
+	tocDepth  int
+}
+
+func loadSettings(info BlogInfo) (*siteSettings, error) {
+	var err error
+	site := &siteSettings{location: time.Local}
+	if tz, ok := info["Timezone"]; ok {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			fmt.Println("Bad Timezone in config.json: " + err.Error())
+		} else {
+			site.location = loc
+		}
+	}
+	if site.highlight, err = loadHighlightOptions(info); err != nil {
+		return nil, err
+	}
+	if site.markdown, err = loadMarkdownRenderer(info); err != nil {
+		return nil, err
+	}
+	site.markdown.Highlight = site.highlight
+	if site.tocDepth, err = loadTOCDepth(info); err != nil {
+		return nil, err
+	}
+	return site, nil
+}
+
+// renderer returns the renderer of a source file: Org-mode for .org
+// files and Markdown for the rest.
+func (site *siteSettings) renderer(file string) Renderer {
+	if isOrgFile(file) {
+		return OrgRenderer{Highlight: site.highlight}
+	}
+	return site.markdown
+}
+
+func LoadBlog(dir string, opts BuildOptions) *Blog {
+
+	info, err := LoadBlogInfo(dir)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	site, err := loadSettings(info)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
 
 	b := new(Blog)
 	b.Info = info
 	b.Dir = dir
+	b.Options = opts
+	b.site = site
+	b.now = time.Now().In(site.location)
 	b.ThemeDir = b.Dir + "themes/" + b.Info["Theme"]
-	b.Years = make([]bool, 100)
+	b.PublishDir, err = publishDir(dir, info)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	b.output = diskOutput{b.PublishDir, dir + MANIFEST_FILE}
 	b.Months = months
 
-	b.Posts = make([]*Article, 500)
+	if opts.BaseURL != "" {
+		b.Info["Url"] = strings.TrimSuffix(opts.BaseURL, "/")
+	}
+
+	b.Posts = make(Articles, 0)
 	b.Nposts = 0
 
 	b.loadAllPosts()
@@ -164,6 +263,50 @@ func LoadBlog(dir string) *Blog {
 	return b
 }
 
+// sourceDirs are the directories of the blog that grom reads.
+var sourceDirs = []string{"post", "drafts", "static", "img", "themes"}
+
+// publishDir returns the PublishDir of config.json, relative to the
+// blog directory unless it is an absolute path. It is public/ by
+// default. Since it is overwritten by the builds and removed by grom
+// clean, it can not be the blog directory, one above it nor one with
+// the sources of the blog.
+func publishDir(dir string, info BlogInfo) (string, error) {
+	pd, ok := info["PublishDir"]
+	if !ok || strings.TrimSpace(pd) == "" {
+		pd = "public"
+	}
+	if !filepath.IsAbs(pd) {
+		pd = dir + pd
+	}
+
+	abs, err := filepath.Abs(pd)
+	if err != nil {
+		return "", err
+	}
+	blogDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	bad := errors.New("Bad PublishDir in config.json: " + pd)
+	if isInside(blogDir, abs) {
+		return "", bad
+	}
+	for _, src := range sourceDirs {
+		src = filepath.Join(blogDir, src)
+		if isInside(src, abs) || isInside(abs, src) {
+			return "", bad
+		}
+	}
+	return checkDirPath(pd), nil
+}
+
+// isInside tells if the path is dir or one of its subdirectories.
+func isInside(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
 func (blog *Blog) loadFilePost(fp string, fi os.FileInfo, err error) error {
 	if err != nil {
 		fmt.Println(err)
@@ -177,18 +320,22 @@ func (blog *Blog) loadFilePost(fp string, fi os.FileInfo, err error) error {
 	//if !strings.HasSuffix(fp, ".org") {
 	//	return nil // file is not org
 	//
-	a, err := ParseArticle(fp)
+	a, err := ParseArticle(fp, blog.site.location)
 	if a == nil {
-		fmt.Println("Error parsing " + err.Error())
+		blog.loadErrors = append(blog.loadErrors,
+			fmt.Errorf("Error parsing %s: %v", strings.TrimPrefix(fp, blog.Dir), err))
+		return nil
+	}
+	if strings.HasPrefix(fp, blog.Dir+"drafts") {
+		a.Draft = true
+	}
+	if a.Draft && !blog.Options.Drafts || !blog.checkSchedule(a) {
+		blog.unpublished = append(blog.unpublished, a)
 		return nil
 	}
 
-	// Array limits not controlled
-	blog.Posts[blog.Nposts] = a
+	blog.Posts = append(blog.Posts, a)
 	blog.Nposts++
-	if a.Date.Year() >= 2000 {
-		blog.Years[a.Date.Year()-2000] = true
-	}
 
 	return nil
 }
@@ -198,9 +345,91 @@ func (blog *Blog) loadAllPosts() {
 	if err != nil {
 		fmt.Println(err)
 	}
-	blog.Posts = blog.Posts[:blog.Nposts]
+	if _, err = os.Stat(blog.Dir + "drafts"); err == nil {
+		err = filepath.Walk(blog.Dir+"drafts", blog.loadFilePost)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
 	sort.Sort(ByDate{blog.Posts})
+	sort.Sort(sort.Reverse(ByDate{blog.Scheduled}))
+	sort.Sort(sort.Reverse(byExpiryDate{blog.Expiring}))
+	blog.indexByDate()
+}
 
+// indexByDate builds the Archive index from the posts, that are
+// already sorted by date.
+func (blog *Blog) indexByDate() {
+	blog.Archive = make([]ArchiveYear, 0)
+	for _, a := range blog.Posts {
+		y, m := a.Date.Year(), int(a.Date.Month())
+		n := len(blog.Archive)
+		if n == 0 || blog.Archive[n-1].Year != y {
+			blog.Archive = append(blog.Archive, ArchiveYear{Year: y})
+			n++
+		}
+		year := &blog.Archive[n-1]
+		k := len(year.Months)
+		if k == 0 || year.Months[k-1].Month != m {
+			year.Months = append(year.Months, ArchiveMonth{Month: m, Name: months[m]})
+			k++
+		}
+		year.Months[k-1].Posts = append(year.Months[k-1].Posts, a)
+	}
+}
+
+// checkSchedule tells if a post is published at the build time. Posts
+// with a future date are only loaded with the Future option and
+// expired posts are never loaded.
+func (blog *Blog) checkSchedule(a *Article) bool {
+	if exp, ok := a.GetExpiryDate(); ok {
+		if !exp.After(blog.now) {
+			return false
+		}
+		blog.Expiring = append(blog.Expiring, a)
+	}
+	if a.Date.After(blog.now) {
+		blog.Scheduled = append(blog.Scheduled, a)
+		return blog.Options.Future
+	}
+	return true
+}
+
+// GetNextUpdate returns the next time the blog must be built again to
+// publish a scheduled post or to remove an expired one.
+func (blog *Blog) GetNextUpdate() (time.Time, bool) {
+	var next time.Time
+	if len(blog.Scheduled) > 0 && !blog.Options.Future {
+		next = blog.Scheduled[0].Date
+	}
+	if len(blog.Expiring) > 0 {
+		exp, _ := blog.Expiring[0].GetExpiryDate()
+		if next.IsZero() || exp.Before(next) {
+			next = exp
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// PrintSchedule shows the scheduled posts and the posts that expire,
+// so a cron job can build the blog again when needed.
+func (blog *Blog) PrintSchedule() {
+	if len(blog.Scheduled) > 0 {
+		fmt.Printf("Scheduled posts:\n")
+		for _, a := range blog.Scheduled {
+			fmt.Printf("  %s  %s\n", a.Date.Format(time.RFC3339), a.Id)
+		}
+	}
+	if len(blog.Expiring) > 0 {
+		fmt.Printf("Expiring posts:\n")
+		for _, a := range blog.Expiring {
+			exp, _ := a.GetExpiryDate()
+			fmt.Printf("  %s  %s\n", exp.Format(time.RFC3339), a.Id)
+		}
+	}
+	if next, ok := blog.GetNextUpdate(); ok {
+		fmt.Printf("Next build needed at %s\n", next.Format(time.RFC3339))
+	}
 }
 
 func (blog *Blog) loadAllStatics() error {
@@ -208,25 +437,28 @@ func (blog *Blog) loadAllStatics() error {
 	if err != nil {
 		return err
 	}
+	defer fd.Close()
 	statics, _ := fd.Readdirnames(-1)
-	blog.Statics = make([]*Article, len(statics))
+	sort.Strings(statics)
+	blog.Statics = make(Articles, 0, len(statics))
 	blog.Nstatics = 0
 	for i := range statics {
-		a, _ := ParseArticle(blog.Dir + "static/" + statics[i])
+		a, err := ParseArticle(blog.Dir+"static/"+statics[i], blog.site.location)
 		if a == nil {
-			return errors.New("Error parsing " + statics[i])
+			blog.loadErrors = append(blog.loadErrors,
+				fmt.Errorf("Error parsing static/%s: %v", statics[i], err))
+			continue
 		}
-		if a != nil {
-			/*
-			 Array limits not controlled
-			*/
-			blog.Statics[i] = a
-			blog.Nstatics++
+		a.static = true
+		if a.Draft && !blog.Options.Drafts {
+			blog.unpublished = append(blog.unpublished, a)
+			continue
 		}
-
+		blog.Statics = append(blog.Statics, a)
+		blog.Nstatics++
 	}
 
-	return err
+	return nil
 }
 
 func (blog *Blog) AddArticle(title string) error {
@@ -235,7 +467,7 @@ func (blog *Blog) AddArticle(title string) error {
 	year := d.Format("2006")
 	month := d.Format("01")
 
-	a, _ := NewArticle(title)
+	a, _ := NewArticle(title, blog.site.location)
 	file := blog.Dir + "post/" + year + "/" + month + "-" + title + ".md"
 	err := a.WriteNewFile(file)
 	if err != nil {
@@ -246,7 +478,7 @@ func (blog *Blog) AddArticle(title string) error {
 
 func (blog *Blog) AddStaticPage(title string) error {
 
-	a, _ := NewArticle(title)
+	a, _ := NewArticle(title, blog.site.location)
 	file := blog.Dir + "static/" + title + ".md"
 	err := a.WriteNewFile(file)
 	if err != nil {
@@ -255,56 +487,81 @@ func (blog *Blog) AddStaticPage(title string) error {
 	return nil
 }
 
-func (blog *Blog) Serve() error {
-	//http.HandleFunc("/ws", blog.DebugServer.WSHandler)
-	//fmt.Println("Añado el handler del websocket")
+func (blog *Blog) Build() (err error) {
 
-	http.ListenAndServe(":9999", http.FileServer(http.Dir(blog.Dir)))
-	return nil
-}
+	blog.manifest = loadManifest(blog.output)
+	defer func() {
+		// the manifest must describe the files of the output even
+		// when the build fails
+		if err != nil {
+			blog.manifest.keepUnbuilt()
+			blog.manifest.save()
+		}
+	}()
 
-func (blog *Blog) Build() error {
+	// a source that can not be parsed would look like a removed one,
+	// so its pages must not be touched
+	if len(blog.loadErrors) > 0 {
+		return blog.loadErrors
+	}
+
+	key, err := blog.makeSiteKey()
+	if err != nil {
+		return err
+	}
+	blog.siteKey = key
+
+	err = blog.parseTemplates()
+	if err != nil {
+		return err
+	}
 
 	fmt.Printf("Building tags ... ")
-	err := blog.makeTags()
+	err = blog.makeTags()
 	if err != nil {
 		return err
 	}
 	fmt.Printf("\n")
 
-	fmt.Printf("Building posts ... ")
-	for i := range blog.Posts {
-		a := blog.Posts[i]
-		if a != nil {
-			err := blog.makeArticle(a)
-			if err != nil {
-				return err
-			}
-		}
+	err = blog.makePermalinks()
+	if err != nil {
+		return err
+	}
+
+	err = blog.makeRedirects()
+	if err != nil {
+		return err
 	}
-	fmt.Printf("\n")
 
-	fmt.Printf("Building statics ... ")
+	err = blog.resolveLinks()
+	if err != nil {
+		return err
+	}
+
+	err = blog.renderArticles()
+	if err != nil {
+		return err
+	}
+
+	jobs := blog.makeTagIndexes()
+	for i := range blog.Posts {
+		jobs = append(jobs, blog.makeArticle(i))
+	}
 	for i := range blog.Statics {
-		a := blog.Statics[i]
-		if a != nil {
-			err := blog.makeStatic(a)
-			if err != nil {
-				return err
-			}
-		}
+		jobs = append(jobs, blog.makeStatic(i))
 	}
-	fmt.Printf("\n")
+	jobs = append(jobs, blog.makeIndex()...)
+	jobs = append(jobs, blog.makeArchive())
 
-	fmt.Printf("Building index ... ")
-	err = blog.makeIndex()
+	fmt.Printf("Building %d pages ... ", len(jobs))
+	err = blog.renderPages(jobs)
 	if err != nil {
 		return err
 	}
 	fmt.Printf("\n")
 
-	fmt.Printf("Building archive ... ")
-	err = blog.makeArchive()
+	fmt.Printf("Building theme ... ")
+	err = blog.makeTheme()
 	if err != nil {
 		return err
 	}
@@ -324,7 +581,11 @@ func (blog *Blog) Build() error {
 	}
 	fmt.Printf("\n")
 
-	return nil
+	blog.manifest.removeStale()
+	fmt.Printf("%d files updated, %d up to date\n",
+		blog.manifest.built, blog.manifest.skipped)
+
+	return blog.manifest.save()
 }
 
 func (blog *Blog) BuildUtils() error {
@@ -334,7 +595,17 @@ func (blog *Blog) BuildUtils() error {
 		return err
 	}
 
-	err = makeRSSFeed(blog)
+	err = makeFeeds(blog)
+	if err != nil {
+		return err
+	}
+
+	err = blog.makeRedirectRules()
+	if err != nil {
+		return err
+	}
+
+	err = blog.makeRedirectPages()
 	if err != nil {
 		return err
 	}
@@ -342,66 +613,125 @@ func (blog *Blog) BuildUtils() error {
 	return nil
 }
 
-func (blog *Blog) GetArticlesByDate(year int, month int) []*Article {
+// GetArticleId returns the tag: URI (RFC 4151) of a post for the feeds.
+// It is built from the blog domain, the post date and its id, so it does
+// not change if the post URL changes.
+func (blog *Blog) GetArticleId(a *Article) string {
+	host := blog.Info["Url"]
+	if u, err := url.Parse(host); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	return "tag:" + host + "," + a.Date.Format("2006-01-02") + ":" + a.Id
+}
 
-	a := make([]*Article, 100)
-	n := 0
-	smonth := ""
-	year = year + 2000
-	syear := fmt.Sprintf("%d", year)
-	if month < 10 {
-		smonth = fmt.Sprintf("0%d", month)
-	} else {
-		smonth = fmt.Sprintf("%d", month)
+// Years tells which years since 2000 have posts, by their index. It
+// is kept for the archive.html of the old themes, copied in every blog
+// by grom create; the themes of now use Archive.
+func (blog *Blog) Years() []bool {
+	years := make([]bool, 100)
+	for _, y := range blog.Archive {
+		if y.Year >= 2000 && y.Year < 2100 {
+			years[y.Year-2000] = true
+		}
 	}
+	return years
+}
 
-	for p := 0; p < blog.Nposts; p++ {
-		if (blog.Posts[p].GetYear() == syear) &&
-			strings.HasPrefix(blog.Posts[p].GetValidId(), smonth) {
+// GetArticlesByDate returns the posts of a month. It returns nil when
+// there are no posts in that month. The old themes give the year as an
+// index of Years.
+func (blog *Blog) GetArticlesByDate(year int, month int) []*Article {
+	if year < 100 {
+		year += 2000
+	}
 
-			a = append(a, blog.Posts[p])
-			n++
+	for _, y := range blog.Archive {
+		if y.Year != year {
+			continue
+		}
+		for _, m := range y.Months {
+			if m.Month == month {
+				return m.Posts
+			}
 		}
 	}
+	return nil
+}
 
-	if n == 0 {
-		return nil
+func (blog *Blog) GetLastArticles() []*Article {
+
+	max_posts := blog.getPostPerPage("PostPerPage")
+
+	n_post_in_index := len(blog.Posts)
+	if n_post_in_index > max_posts {
+		n_post_in_index = max_posts
 	}
-	return a
+
+	return blog.Posts[:n_post_in_index]
 }
 
-func (blog *Blog) GetLastArticles() []*Article {
+// getPostPerPage reads a posts per page value from config.json. Only
+// PostPerPage is mandatory, the other keys default to it.
+func (blog *Blog) getPostPerPage(key string) int {
 
 	var max string
 	var ok bool
 
-	if max, ok = blog.Info["PostPerPage"]; !ok {
+	if max, ok = blog.Info[key]; !ok {
+		if key != "PostPerPage" {
+			return blog.getPostPerPage("PostPerPage")
+		}
 		panic(errors.New("No PostPerPage defined in config.json"))
 	}
 
 	max_posts, err := strconv.ParseInt(max, 10, 0)
-	if err != nil {
-		panic(errors.New("Bad value for PostPerPage defined in config.json"))
+	if err != nil || max_posts < 1 {
+		panic(errors.New("Bad value for " + key + " defined in config.json"))
 	}
+	return int(max_posts)
+}
 
-	n_post_in_index := len(blog.Posts)
-	if n_post_in_index > int(max_posts) {
-		n_post_in_index = int(max_posts)
+// GetPublishedPosts returns the posts without the drafts. Feeds, the
+// sitemap and the tag pages only use these.
+func (blog *Blog) GetPublishedPosts() Articles {
+	published := make(Articles, 0, len(blog.Posts))
+	for _, a := range blog.Posts {
+		if !a.Draft {
+			published = append(published, a)
+		}
 	}
-
-	return blog.Posts[:n_post_in_index]
+	return published
 }
 
-func (blog *Blog) GetSelectedPost() *Article {
-	return blog.Posts[blog.Selected]
+// GetFeedArticles returns the last published posts, as
+// GetLastArticles does for the index page.
+func (blog *Blog) GetFeedArticles() []*Article {
+	posts := blog.GetPublishedPosts()
+	n := len(blog.GetLastArticles())
+	if len(posts) > n {
+		posts = posts[:n]
+	}
+	return posts
 }
 
-func (blog *Blog) GetSelectedStatic() *Article {
-	return blog.Statics[blog.Selected]
+// renderArticles renders every post and static page once for the
+// build, with its TOC and its summary.
+func (blog *Blog) renderArticles() error {
+	words, err := blog.summaryWords()
+	if err != nil {
+		return err
+	}
+
+	url := blog.Info["Url"]
+	for _, a := range append(append(Articles{}, blog.Posts...), blog.Statics...) {
+		a.render(blog.site, url)
+		a.makeSummary(blog.site, url, words)
+	}
+	return nil
 }
 
 func (blog *Blog) GetHTMLContent(a *Article) string {
-	return Markdown2HTML(a.Content, blog.Info["Url"])
+	return a.contentHTML(blog.site, blog.Info["Url"])
 }
 
 func (blog *Blog) GetPopularTags() Tags {
@@ -439,88 +769,55 @@ func (s ByDate) Less(i, j int) bool {
 	return s.Articles[i].Date.After(s.Articles[j].Date)
 }
 
-func (blog *Blog) makeIndex() error {
+type byExpiryDate struct{ Articles }
 
-	f, err := os.Create(blog.Dir + "index.html")
-	if err != nil {
-		return err
-	}
+func (s byExpiryDate) Less(i, j int) bool {
+	a, _ := s.Articles[i].GetExpiryDate()
+	b, _ := s.Articles[j].GetExpiryDate()
+	return a.After(b)
+}
 
-	t := template.New("main")
-	_, err = t.ParseFiles(blog.ThemeDir+"/main.html",
-		blog.ThemeDir+"/last-posts.html")
-	if err != nil {
-		return err
-	}
+// makeIndex returns the pages of the home: index.html with the last
+// posts and page/N/index.html with the older ones.
+func (blog *Blog) makeIndex() []renderJob {
 
-	err = t.ExecuteTemplate(f, "main", blog)
-	if err != nil {
-		return err
+	pagers := blog.paginate(blog.Posts, blog.getPostPerPage("PostPerPage"), "index.html", "")
+	jobs := make([]renderJob, len(pagers))
+	for i, p := range pagers {
+		page := blog.newPage()
+		page.Pager = p
+		key := hashOf("index", p.key(), contentKey(p.Posts))
+		jobs[i] = renderJob{p.file, key, "last-posts", page}
 	}
-	return nil
+	return jobs
 }
 
-func (blog *Blog) makeStatic(a *Article) error {
-	f, err := os.Create(blog.Dir + "html/static-" + a.Id + ".html")
-	if err != nil {
-		return err
-	}
-	s := -1
-	// search the index of the article
-	for i := range blog.Statics {
-		if a.Id == blog.Statics[i].Id {
-			s = i
-			break
-		}
-	}
-	if s < 0 {
-		return errors.New("Bad static to build")
-	}
+func (blog *Blog) makeStatic(i int) renderJob {
+	a := blog.Statics[i]
+	page := blog.newPage()
+	page.Post = a
 
-	blog.Selected = s
-	t := template.New("main")
-	_, err = t.ParseFiles(blog.ThemeDir+"/main.html",
-		blog.ThemeDir+"/static.html")
-	if err != nil {
-		return err
-	}
-	t.ExecuteTemplate(f, "main", blog)
-
-	return nil
+	key := hashOf("static", a.hash, listKey(a.links), listKey(a.Backlinks))
+	return renderJob{a.file(), key, "static", page}
 }
 
-func (blog *Blog) makeArticle(a *Article) error {
-
-	err := os.MkdirAll(blog.Dir+"html/"+a.GetYear(), 0755)
-	if err != nil {
-		return err
-	}
-	f, err := os.Create(blog.Dir + "html/" + a.GetYear() + "/" + a.GetValidId() + ".html")
-	if err != nil {
-		return err
-	}
-	s := -1
-	// search the index of the article
-	for i := range blog.Posts {
-		if (blog.Posts[i] != nil) && (a.Id == blog.Posts[i].Id) {
-			s = i
-			break
-		}
+func (blog *Blog) makeArticle(i int) renderJob {
+	a := blog.Posts[i]
+	page := blog.newPage()
+	page.Post = a
+	neighbours := make(Articles, 0, 2)
+	if i > 0 {
+		page.Next = blog.Posts[i-1]
+		neighbours = append(neighbours, page.Next)
 	}
-	if s < 0 {
-		return errors.New("Bad article to build")
+	if i < len(blog.Posts)-1 {
+		page.Prev = blog.Posts[i+1]
+		neighbours = append(neighbours, page.Prev)
 	}
 
-	blog.Selected = s
-	t := template.New("main")
-	_, err = t.ParseFiles(blog.ThemeDir+"/main.html",
-		blog.ThemeDir+"/post.html")
-	if err != nil {
-		return err
-	}
-	t.ExecuteTemplate(f, "main", blog)
-
-	return nil
+	key := hashOf("post", a.hash, listKey(neighbours), listKey(a.links),
+		listKey(a.Backlinks))
+	return renderJob{a.file(), key, "post", page}
 }
 
 func (blog *Blog) makeTags() error {
@@ -528,25 +825,29 @@ func (blog *Blog) makeTags() error {
 	return buildTags(blog)
 }
 
-func (blog *Blog) makeArchive() error {
+func (blog *Blog) makeArchive() renderJob {
 
-	f, err := os.Create(blog.Dir + "html/archive.html")
-	if err != nil {
-		return err
-	}
+	key := hashOf("archive", listKey(blog.Posts))
+	return renderJob{"html/archive.html", key, "archive", blog.newPage()}
+}
 
-	t := template.New("main")
-	_, err = t.ParseFiles(blog.ThemeDir+"/main.html",
-		blog.ThemeDir+"/archive.html")
+// makeTheme publishes the files of the theme that are not templates,
+// like the stylesheets.
+func (blog *Blog) makeTheme() error {
+	files, err := ioutil.ReadDir(blog.ThemeDir)
 	if err != nil {
 		return err
 	}
-
-	err = t.ExecuteTemplate(f, "main", blog)
-	if err != nil {
-		return err
+	for _, fi := range files {
+		if fi.IsDir() || strings.HasSuffix(fi.Name(), ".html") {
+			continue
+		}
+		err = blog.publishFile(blog.ThemeDir+"/"+fi.Name(),
+			"themes/"+blog.Info["Theme"]+"/"+fi.Name())
+		if err != nil {
+			return err
+		}
 	}
-
 	return nil
 }
 
@@ -556,47 +857,54 @@ func (blog *Blog) makeThumbs() error {
 	if err != nil {
 		return err
 	}
-	imgs, _ := fd.Readdirnames(-1)
-	for i := range imgs {
-		if imgs[i] != "thumbs" {
-			blog.createThumb(imgs[i])
+	defer fd.Close()
+	imgs, _ := fd.Readdir(-1)
+	for _, fi := range imgs {
+		if fi.IsDir() {
+			continue
+		}
+		err = blog.publishFile(blog.Dir+"img/"+fi.Name(), "img/"+fi.Name())
+		if err != nil {
+			return err
 		}
+		blog.createThumb(fi)
 	}
 
 	return nil
 }
 
-func (blog *Blog) createThumb(file string) error {
+func (blog *Blog) createThumb(fi os.FileInfo) error {
 
-	var img1 image.Image
-	var delta float32
+	src := blog.Dir + "img/" + fi.Name()
+	key := hashOf("thumb", src, fmt.Sprint(fi.Size()), fi.ModTime().String())
+	return blog.writeOutput("img/thumbs/"+fi.Name(), key, func(w io.Writer) error {
+		var img1 image.Image
+		var delta float32
 
-	_, err := os.Stat(blog.Dir + "img/thumbs/" + file)
-	if err == nil {
-		return nil // the thumb exits. exit
-	}
-	fimg, err := os.Open(blog.Dir + "img/" + file)
-	img1, err = jpeg.Decode(fimg)
-	if err != nil {
-		return err
-	}
-
-	r := img1.Bounds()
-	s := r.Size()
+		fimg, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer fimg.Close()
+		img1, err = jpeg.Decode(fimg)
+		if err != nil {
+			return err
+		}
 
-	if s.X > 500 {
-		delta = float32(s.X) / 500.0
-	} else {
-		delta = 1.0
-	}
+		r := img1.Bounds()
+		s := r.Size()
 
-	nx := float32(s.X) / delta
-	ny := float32(s.Y) / delta
+		if s.X > 500 {
+			delta = float32(s.X) / 500.0
+		} else {
+			delta = 1.0
+		}
 
-	img2 := Resize(img1, r, int(nx), int(ny))
+		nx := float32(s.X) / delta
+		ny := float32(s.Y) / delta
 
-	fimg2, _ := os.Create(blog.Dir + "img/thumbs/" + file)
-	jpeg.Encode(fimg2, img2, &jpeg.Options{jpeg.DefaultQuality})
+		img2 := Resize(img1, r, int(nx), int(ny))
 
-	return nil
+		return jpeg.Encode(w, img2, &jpeg.Options{Quality: jpeg.DefaultQuality})
+	})
 }
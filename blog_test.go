@@ -0,0 +1,74 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishDir(t *testing.T) {
+	dir := "/home/me/blog/"
+	good := map[string]string{
+		"":                "/home/me/blog/public/",
+		"public":          "/home/me/blog/public/",
+		"site/html":       "/home/me/blog/site/html/",
+		"/var/www/blog":   "/var/www/blog/",
+		"../blog-public/": "/home/me/blog/../blog-public/",
+		"posts":           "/home/me/blog/posts/",
+	}
+	for pd, want := range good {
+		got, err := publishDir(dir, BlogInfo{"PublishDir": pd})
+		if err != nil || got != want {
+			t.Errorf("PublishDir %q: got %q %v, want %q", pd, got, err, want)
+		}
+	}
+
+	for _, pd := range []string{".", "./", "/home/me/blog", "..", "/", "/home",
+		"post", "img/", "themes/default", "static/pages", "drafts", "post/../img"} {
+		if got, err := publishDir(dir, BlogInfo{"PublishDir": pd}); err == nil {
+			t.Errorf("PublishDir %q is accepted as %q", pd, got)
+		}
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	site, err := loadSettings(BlogInfo{"Timezone": "Asia/Tokyo", "TOCDepth": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site.location.String() != "Asia/Tokyo" || site.tocDepth != 2 {
+		t.Errorf("settings not loaded: %v %d", site.location, site.tocDepth)
+	}
+
+	// A key removed from config.json goes back to its default.
+	site, err = loadSettings(BlogInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site.location != time.Local || site.tocDepth != DEFAULT_TOC_DEPTH {
+		t.Errorf("settings not reset: %v %d", site.location, site.tocDepth)
+	}
+
+	if _, err := loadSettings(BlogInfo{"HighlightStyle": "nope"}); err == nil {
+		t.Error("unknown HighlightStyle accepted")
+	}
+}
@@ -21,17 +21,11 @@
 package main
 
 import (
-	"fmt"
-	"io/ioutil"
-	"log"
-	"math/rand"
-	"os"
+	"io"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
-	"time"
-
-	"github.com/fsnotify/fsnotify"
 )
 
 const (
@@ -71,48 +65,48 @@ func normalizeURL(url string) string {
 	return s
 }
 
-func (t Tag) makeTagIndex(blog *Blog) error {
-	f, err := os.Create(blog.Dir + "/tags/" + t.getValidId() + ".html")
-	if err != nil {
-		return err
-	}
-
-	blog.TagSelected = t
-
-	tmpl := template.New("main")
-	_, err = tmpl.ParseFiles(blog.ThemeDir+"/main.html",
-		blog.ThemeDir+"/tag-index.html")
-	if err != nil {
-		return err
-	}
+func (t Tag) makeTagIndex(blog *Blog) []renderJob {
+	id := t.getValidId()
+	pagers := blog.paginate(t.Posts, blog.getPostPerPage("TagPostPerPage"),
+		"tags/"+id+".html", "tags/"+id+"/")
+
+	jobs := make([]renderJob, len(pagers))
+	for i, p := range pagers {
+		page := blog.newPage()
+		page.TagSelected = t
+		page.Pager = p
+		page.Feeds = t.tagFeedLinks(blog)
+		key := hashOf("tag", t.Name, p.key(), listKey(p.Posts))
+		jobs[i] = renderJob{p.file, key, "tag-index", page}
+	}
+	return jobs
+}
 
-	err = tmpl.ExecuteTemplate(f, "main", blog)
-	if err != nil {
-		return err
+func makeAllTagsIndex(blog *Blog) renderJob {
+	names := make([]string, 0, len(blog.BlogTags))
+	for id, t := range blog.BlogTags {
+		names = append(names, id+":"+t.Name)
 	}
+	sort.Strings(names)
 
-	return nil
+	key := hashOf(append([]string{"all-tags"}, names...)...)
+	return renderJob{"tags/index.html", key, "all-tags", blog.newPage()}
 }
 
-func makeAllTagsIndex(blog *Blog) error {
-	f, err := os.Create(blog.Dir + "/tags/index.html")
-	if err != nil {
-		return err
+// makeTagIndexes returns the pages of every tag, sorted by tag, and
+// the page with all the tags.
+func (blog *Blog) makeTagIndexes() []renderJob {
+	ids := make([]string, 0, len(blog.BlogTags))
+	for id := range blog.BlogTags {
+		ids = append(ids, id)
 	}
+	sort.Strings(ids)
 
-	tmpl := template.New("main")
-	_, err = tmpl.ParseFiles(blog.ThemeDir+"/main.html",
-		blog.ThemeDir+"/all-tags.html")
-	if err != nil {
-		return err
+	jobs := make([]renderJob, 0, len(ids)+1)
+	for _, id := range ids {
+		jobs = append(jobs, blog.BlogTags[id].makeTagIndex(blog)...)
 	}
-
-	err = tmpl.ExecuteTemplate(f, "main", blog)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return append(jobs, makeAllTagsIndex(blog))
 }
 
 func buildTags(blog *Blog) error {
@@ -121,8 +115,8 @@ func buildTags(blog *Blog) error {
 
 	for i := range blog.Posts {
 		a := blog.Posts[i]
-		if a != nil {
-			names := strings.Split(blog.Posts[i].Meta["Tags"], ",")
+		if a != nil && !a.Draft {
+			names := a.GetTags()
 			for t := 0; t < len(names); t++ {
 				var tag Tag
 				var ok bool
@@ -144,208 +138,40 @@ func buildTags(blog *Blog) error {
 		}
 	}
 
-	for _, v := range blog.BlogTags {
-		err := v.makeTagIndex(blog)
-		if err != nil {
-			return err
-		}
-	}
-
-	makeAllTagsIndex(blog)
-
 	return nil
 }
 
 var sitemapTemplate = `{{define "sitemap"}}<?xml version="1.0" encoding="UTF-8"?>
 <urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
-{{$b:=.}}
-{{ range $a:=.Posts}}
-{{ if $a}}
+{{ range $a:=.GetPublishedPosts}}
   <url>
-      <loc>{{$b.Info.Url}}/html/{{$a.GetYear}}/{{$a.GetValidId}}.html</loc>
+      <loc>{{$a.URL}}</loc>
       <lastmod>{{$a.DateFormat.SitemapDateFormat}}</lastmod>
       <changefreq>monthly</changefreq>
       <priority>0.8</priority>
    </url>
 {{end}}
-{{end}}
 {{ range $a:=.Statics}}
   <url>
-      <loc>{{$b.Info.Url}}/html/{{$a.GetValidId}}.html</loc>
+      <loc>{{$a.URL}}</loc>
       <lastmod>{{$a.DateFormat.SitemapDateFormat}}</lastmod>
       <changefreq>monthly</changefreq>
       <priority>0.8</priority>
    </url>
-</urlset>
-{{end}}
 {{end}}
-`
-
-var atomTemplate = `{{define "atom"}}<?xml version="1.0" encoding="utf-8"?>
-<feed xmlns="http://www.w3.org/2005/Atom">
-<id>{{.Info.Url}}/atom.xml</id>
-<title>{{.Info.Name}}</title>
-<subtitle>{{.Info.Subtitle}}</subtitle>
-<link href="{{.Info.Url}}/atom.xml" rel="self" />
-<link href="{{.Info.Url}}" />
-<updated>{{.GetFeedDate}}</updated>
-{{$b:=.}}
-{{ range $a:=.GetLastArticles}}
-
-<entry>
-<title>{{$a.Title}}</title>
-<link href="{{$b.Info.Url}}/html/{{$a.GetYear}}/{{$b.GetArticleId $a}}.html" />
-<id>{{$b.Info.Url}}/html/{{$a.GetValidId}}.html</id>
-<updated>{{$a.DateFormat.AtomDateFormat}}</updated>
-<author>
-<name>{{$a.Meta.Author}}</name>
-</author>
-<description><![CDATA[{{$b.GetHTMLContent $a}}]]></description>
-</entry>
-
-{{end}}
-</feed>
-{{end}}
-`
-
-var rssTemplate = `{{define "rss"}}<?xml version="1.0" encoding="utf-8" ?>
-<rss version="2.0">
-<channel>
-<title>{{.Info.Name}}</title>
-<link>{{.Info.Url}}</link>
-<description>{{.Info.Subtitle}}</description>
-{{$b:=.}}
-{{ range $a:=.GetLastArticles}}
-<item>
-<title>{{$a.Title}}</title>
-<pubDate>{{$a.DateFormat.RSSDateFormat}}</pubDate>
-<guid>{{$b.Info.Url}}/html/{{$a.GetYear}}/{{$a.GetValidId}}.html</guid>
-<link>{{$b.Info.Url}}/html/{{$a.GetYear}}/{{$a.GetValidId}}.html</link>
-<description><![CDATA[{{$b.GetHTMLContent $a}}]]></description>
-</item>
-{{end}}
-</channel>
-</rss>
+</urlset>
 {{end}}
 `
 
 func makeSitemap(blog *Blog) error {
-	f, err := os.Create(blog.Dir + "sitemap.xml")
-	if err != nil {
-		return err
-	}
-
-	t := template.New("sitemap")
-	_, err = t.Parse(sitemapTemplate)
-	if err != nil {
-		return err
-	}
-
-	err = t.ExecuteTemplate(f, "sitemap", blog)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func getFeedDate() string {
-	t := time.Now()
-	return t.Format(AtomDateFormat)
-}
-
-func makeAtomFeed(blog *Blog) error {
-	f, err := os.Create(blog.Dir + "atom.xml")
-	if err != nil {
-		return err
-	}
-
-	t := template.New("atom")
-	_, err = t.Parse(atomTemplate)
-	if err != nil {
-		return err
-	}
-
-	err = t.ExecuteTemplate(f, "atom", blog)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func makeRSSFeed(blog *Blog) error {
-	f, err := os.Create(blog.Dir + "rss.xml")
-	if err != nil {
-		return err
-	}
-
-	t := template.New("rss")
-	_, err = t.Parse(rssTemplate)
-	if err != nil {
-		return err
-	}
-
-	err = t.ExecuteTemplate(f, "rss", blog)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func postsWatcher(dir string, blog *Blog) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer watcher.Close()
-
-	done := make(chan bool)
-	go func() {
-		for {
-			select {
-			case event := <-watcher.Events:
-				log.Println("event:", event)
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					log.Println("modified file:", event.Name)
-				}
-
-				// avisar al websocket server para que envie la orden
-				// de recarga
-				if blog.DebugServer != nil {
-					blog.DebugServer.Send([]byte("reload"))
-				}
-
-				// case err := <-blog.UpdateWatcher.Errors:
-				// 	log.Println("error:", err)
-			}
-		}
-	}()
-
-	// Add watcher to every post directory
-	dirs, err := ioutil.ReadDir("post/")
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-
-	for _, d := range dirs {
-		if d.IsDir() {
-			watcher.Add(dir + "post/" + d.Name())
-			//fmt.Printf("Add update watcher to %s\n", dir+"post/"+d.Name())
+	key := hashOf("sitemap", listKey(blog.GetPublishedPosts()))
+	return blog.buildFile("sitemap.xml", key, func(f io.Writer) error {
+		t := template.New("sitemap")
+		_, err := t.Parse(sitemapTemplate)
+		if err != nil {
+			return err
 		}
-	}
-
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-
-	<-done
-}
 
-func getTempDirectory() string {
-	rand.Seed(time.Now().UTC().UnixNano())
-	return fmt.Sprintf("/tmp/grom-%d/", 65821+rand.Intn(228546-6521))
+		return t.ExecuteTemplate(f, "sitemap", blog)
+	})
 }
@@ -0,0 +1,308 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+/*
+ RSS, Atom and JSON feeds. Besides the feeds of the whole blog, every
+ tag has its own feeds in tags/<id>.xml (RSS) and tags/<id>.atom.xml
+ (Atom).
+*/
+
+// Feed is the data of the feed templates. It embeds the blog, like
+// Page does for the theme templates.
+type Feed struct {
+	*Blog
+	Title    string
+	Link     string // the page of the feed
+	Self     string // the feed itself
+	Articles Articles
+}
+
+// FeedLink is a feed announced in the <head> of a page.
+type FeedLink struct {
+	Title string
+	URL   string
+	Type  string
+}
+
+var atomTemplate = `{{define "atom"}}<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+<id>{{xml .Self}}</id>
+<title>{{xml .Title}}</title>
+<subtitle>{{xml .Info.Subtitle}}</subtitle>
+<link href="{{xml .Self}}" rel="self" type="application/atom+xml" />
+<link href="{{xml .Link}}" rel="alternate" type="text/html" />
+<updated>{{.GetFeedDate}}</updated>
+<author>
+<name>{{xml .Info.Owner}}</name>
+</author>
+<generator uri="https://github.com/sdemingo/grom">Grom</generator>
+{{$b:=.}}
+{{ range $a:=.Articles}}
+
+<entry>
+<title>{{xml $a.Title}}</title>
+<link href="{{xml $a.URL}}" rel="alternate" type="text/html" />
+<id>{{$b.GetArticleId $a}}</id>
+<published>{{$a.DateFormat.AtomDateFormat}}</published>
+<updated>{{$a.DateFormat.AtomUpdatedFormat}}</updated>
+{{with $a.Meta.String "Author"}}<author>
+<name>{{xml .}}</name>
+</author>
+{{end}}{{ range $t:=$a.GetTags}}<category term="{{xml $t}}" />
+{{end}}<content type="html">{{xml ($b.GetFeedContent $a)}}</content>
+</entry>
+
+{{end}}
+</feed>
+{{end}}
+`
+
+var rssTemplate = `{{define "rss"}}<?xml version="1.0" encoding="utf-8" ?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+<title>{{xml .Title}}</title>
+<link>{{xml .Link}}</link>
+<description>{{xml .Info.Subtitle}}</description>
+<atom:link href="{{xml .Self}}" rel="self" type="application/rss+xml" />
+{{$b:=.}}
+{{ range $a:=.Articles}}
+<item>
+<title>{{xml $a.Title}}</title>
+<pubDate>{{$a.DateFormat.RSSDateFormat}}</pubDate>
+<guid>{{xml $a.URL}}</guid>
+<link>{{xml $a.URL}}</link>
+{{ range $t:=$a.GetTags}}<category>{{xml $t}}</category>
+{{end}}<description><![CDATA[{{$b.GetFeedContent $a}}]]></description>
+</item>
+{{end}}
+</channel>
+</rss>
+{{end}}
+`
+
+// feedFuncs are the functions of the feed templates.
+var feedFuncs = template.FuncMap{
+	"xml": xmlEscape,
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// GetFeedDate returns the date of the last post of the feed, so the
+// feed only changes when a post is published.
+func (feed *Feed) GetFeedDate() string {
+	if len(feed.Articles) == 0 {
+		return feed.now.Format(AtomDateFormat)
+	}
+	latest := feed.Articles[0].GetUpdated()
+	for _, a := range feed.Articles[1:] {
+		if a.GetUpdated().After(latest) {
+			latest = a.GetUpdated()
+		}
+	}
+	return latest.Format(AtomDateFormat)
+}
+
+// makeFeeds builds the feeds of the blog and of every tag.
+func makeFeeds(blog *Blog) error {
+	url := blog.Info["Url"]
+	site := &Feed{blog, blog.Info["Name"], url + "/", "", blog.GetFeedArticles()}
+	err := makeRSSFeed(site, "rss.xml")
+	if err != nil {
+		return err
+	}
+	err = makeAtomFeed(site, "atom.xml")
+	if err != nil {
+		return err
+	}
+	err = makeJSONFeed(site, "feed.json")
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(blog.BlogTags))
+	for id := range blog.BlogTags {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	max := blog.getPostPerPage("TagFeedItems")
+	for _, id := range ids {
+		t := blog.BlogTags[id]
+		posts := t.Posts
+		if len(posts) > max {
+			posts = posts[:max]
+		}
+		feed := &Feed{blog, blog.Info["Name"] + ": " + t.Name,
+			url + "/tags/" + id + ".html", "", posts}
+
+		err = makeRSSFeed(feed, "tags/"+id+".xml")
+		if err != nil {
+			return err
+		}
+		err = makeAtomFeed(feed, "tags/"+id+".atom.xml")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagFeedLinks returns the feeds of a tag for its tag page.
+func (t Tag) tagFeedLinks(blog *Blog) []FeedLink {
+	url := blog.Info["Url"] + "/tags/" + t.getValidId()
+	title := blog.Info["Name"] + ": " + t.Name
+	return []FeedLink{
+		{title, url + ".xml", "application/rss+xml"},
+		{title, url + ".atom.xml", "application/atom+xml"},
+	}
+}
+
+func makeAtomFeed(feed *Feed, file string) error {
+	feed.Self = feed.Info["Url"] + "/" + file
+	key := hashOf("atom", feed.Title, feed.Link, contentKey(feed.Articles))
+	return feed.buildFile(file, key, func(f io.Writer) error {
+		t := template.New("atom").Funcs(feedFuncs)
+		_, err := t.Parse(atomTemplate)
+		if err != nil {
+			return err
+		}
+
+		return t.ExecuteTemplate(f, "atom", feed)
+	})
+}
+
+func makeRSSFeed(feed *Feed, file string) error {
+	feed.Self = feed.Info["Url"] + "/" + file
+	key := hashOf("rss", feed.Title, feed.Link, contentKey(feed.Articles))
+	return feed.buildFile(file, key, func(f io.Writer) error {
+		t := template.New("rss").Funcs(feedFuncs)
+		_, err := t.Parse(rssTemplate)
+		if err != nil {
+			return err
+		}
+
+		return t.ExecuteTemplate(f, "rss", feed)
+	})
+}
+
+/*
+   JSON Feed 1.1 (https://jsonfeed.org/version/1.1)
+*/
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	Id            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	Summary       string           `json:"summary,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+// absoluteURL returns the URL of a blog file, like the image of a post.
+func (blog *Blog) absoluteURL(path string) string {
+	if path == "" || strings.Contains(path, "://") {
+		return path
+	}
+	return blog.Info["Url"] + "/" + strings.TrimPrefix(path, "/")
+}
+
+func (feed *Feed) jsonItem(a *Article) jsonFeedItem {
+	item := jsonFeedItem{
+		Id:            feed.GetArticleId(a),
+		URL:           a.URL(),
+		Title:         a.Title,
+		ContentHTML:   feed.GetFeedContent(a),
+		Image:         feed.absoluteURL(a.Meta.String("Image")),
+		DatePublished: a.Date.Format(AtomDateFormat),
+		Tags:          a.GetTags(),
+	}
+	if !a.GetUpdated().Equal(a.Date) {
+		item.DateModified = a.GetUpdated().Format(AtomDateFormat)
+	}
+	if a.HasMore {
+		item.Summary = htmlText(a.Summary)
+	}
+	if author := a.Meta.String("Author"); author != "" {
+		item.Authors = []jsonFeedAuthor{{author}}
+	}
+	return item
+}
+
+func makeJSONFeed(feed *Feed, file string) error {
+	feed.Self = feed.Info["Url"] + "/" + file
+	key := hashOf("json", feed.Title, feed.Link, contentKey(feed.Articles))
+	return feed.buildFile(file, key, func(f io.Writer) error {
+		jf := jsonFeed{
+			Version:     "https://jsonfeed.org/version/1.1",
+			Title:       feed.Title,
+			HomePageURL: feed.Link,
+			FeedURL:     feed.Self,
+			Description: feed.Info["Subtitle"],
+			Items:       make([]jsonFeedItem, 0, len(feed.Articles)),
+		}
+		if feed.Info["Owner"] != "" {
+			jf.Authors = []jsonFeedAuthor{{feed.Info["Owner"]}}
+		}
+		for _, a := range feed.Articles {
+			jf.Items = append(jf.Items, feed.jsonItem(a))
+		}
+
+		b, err := json.MarshalIndent(jf, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(b)
+		return err
+	})
+}
@@ -0,0 +1,91 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildSample builds the sample blog in memory.
+func buildSample(t *testing.T) (*Blog, *memOutput) {
+	blog := LoadBlog("sample-blog/", BuildOptions{})
+	if blog == nil {
+		t.Fatal("Error during blog load")
+	}
+	out := newMemOutput()
+	blog.output = out
+	if err := blog.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return blog, out
+}
+
+// TestJSONFeed checks feed.json against the JSON Feed 1.1 spec.
+func TestJSONFeed(t *testing.T) {
+	blog, out := buildSample(t)
+	b, err := out.ReadFile("feed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var feed map[string]interface{}
+	if err = json.Unmarshal(b, &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed["version"] != "https://jsonfeed.org/version/1.1" {
+		t.Errorf("version is %v", feed["version"])
+	}
+	if feed["title"] != blog.Info["Name"] {
+		t.Errorf("title is %v", feed["title"])
+	}
+	for _, key := range []string{"home_page_url", "feed_url"} {
+		if u, _ := feed[key].(string); !strings.HasPrefix(u, blog.Info["Url"]+"/") {
+			t.Errorf("%s is %q, want an absolute URL", key, u)
+		}
+	}
+
+	items, ok := feed["items"].([]interface{})
+	if !ok || len(items) != len(blog.GetFeedArticles()) {
+		t.Fatalf("items are %v", feed["items"])
+	}
+	for _, i := range items {
+		item := i.(map[string]interface{})
+		if id, _ := item["id"].(string); id == "" {
+			t.Errorf("item without id: %v", item)
+		}
+		if _, ok := item["content_html"].(string); !ok {
+			t.Errorf("item without content_html: %v", item)
+		}
+		if u, _ := item["url"].(string); !strings.HasPrefix(u, blog.Info["Url"]+"/") {
+			t.Errorf("item url is %q", u)
+		}
+		for _, key := range []string{"date_published", "date_modified"} {
+			if d, ok := item[key].(string); ok {
+				if _, err := time.Parse(time.RFC3339, d); err != nil {
+					t.Errorf("%s: %v", key, err)
+				}
+			}
+		}
+	}
+}
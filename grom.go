@@ -49,10 +49,19 @@ const HELP = `    usage: grom [cmd] [args]
 	      
 	      - create     : Create a new blog
 	      - build      : Build html files from the sources
-              - clean      : Remove html files
+                             --drafts : build the draft posts too
+                             --future : build the posts with a future date too
+              - clean      : Remove the generated site
+              - gen-css-style [style] : Write the stylesheet of the code
+                             highlighting style in the theme
               - serve      : Serve the blog on a builtin web service
+                             --bind <addr> : address to listen on (localhost)
+                             --port <port> : port to listen on (9999), 0 picks a free one
+                             --base-url <url> : root URL of the preview
 	      - add-post   : Create a new post
 	      - add-static : Create a new static page 
+	      - rename <old-id> <new-id> : Change the id of a post, keeping
+	                     its old URL as an alias
 	      - help       : Show this message
 `
 
@@ -67,7 +76,7 @@ func create_post(args []string) {
 	dir := checkDirPath(pwd)
 	title := args[1]
 
-	blog := LoadBlog(dir)
+	blog := LoadBlog(dir, BuildOptions{})
 	if blog == nil {
 		fmt.Printf("Error during blog load\n")
 	}
@@ -92,7 +101,7 @@ func create_static(args []string) {
 	dir := checkDirPath(pwd)
 	title := args[1]
 
-	blog := LoadBlog(dir)
+	blog := LoadBlog(dir, BuildOptions{})
 	if blog == nil {
 		fmt.Printf("Error during blog load\n")
 	}
@@ -125,51 +134,64 @@ func create_blog(args []string) {
 
 func serve_blog(args []string) {
 
+	var bind, baseURL string
+	var port int
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.StringVar(&bind, "bind", "localhost", "address to listen on")
+	flags.IntVar(&port, "port", 9999, "port to listen on, 0 picks a free one")
+	flags.StringVar(&baseURL, "base-url", "", "root URL of the preview")
+	flags.Parse(args[1:])
+
 	pwd, _ := os.Getwd()
 	dir := checkDirPath(pwd)
 
-	tmpdir := dir
-	//tmpdir := getTempDirectory()
-	//fmt.Printf("Exporting blog to draft space in %s\nPlease wait ...\n\n", tmpdir)
-	//CopyDir(dir, tmpdir)
-	blog := LoadBlog(tmpdir)
-	if blog == nil {
-		fmt.Printf("Error during blog load\n")
+	l, err := listen(bind, port)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if baseURL == "" {
+		baseURL = previewURL(bind, l)
 	}
 
-	//go postsWatcher(dir, blog)
-
-	//blog.DebugServer = NewWebSockServer()
-
-	fmt.Printf("Load info from: %s\n", blog.Info["Name"])
-
-	blog.Info["Url"] = "http://localhost:9999"
-
-	err := blog.Build()
+	// drafts and scheduled posts are always shown in the live preview,
+	// which is built in memory, so it can not be deployed by mistake
+	preview := newPreview(dir, BuildOptions{Drafts: true, Future: true, BaseURL: baseURL})
+	err = preview.build()
+	if preview.blog == nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Load info from: %s\n", preview.blog.Info["Name"])
 	if err != nil {
 		fmt.Println(err)
 	} else {
 		fmt.Printf("Build blog succesfully\n")
 	}
 
-	warning := `
-        Blog has been build using a testing root URL. 
-        Remember build again before push it on production.
-`
-	fmt.Printf(warning)
-	fmt.Printf("\nYou can get a live preview of your blog on %s\n", blog.Info["Url"])
-	err = blog.Serve()
+	fmt.Printf("\nYou can get a live preview of your blog on %s\n", baseURL)
+	fmt.Printf("The blog is built again when its files change\n")
+	err = preview.serve(l)
+	if err != nil {
+		fmt.Println(err)
+	}
 }
 
 func build_blog(args []string) {
 
+	var opts BuildOptions
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	flags.BoolVar(&opts.Drafts, "drafts", false, "build the draft posts too")
+	flags.BoolVar(&opts.Future, "future", false, "build the posts with a future date too")
+	flags.Parse(args[1:])
+
 	pwd, err := os.Getwd()
 	if err != nil {
 		fmt.Printf("Current directory is not Grom blog\n")
 		return
 	}
 	dir := checkDirPath(pwd)
-	blog := LoadBlog(dir)
+	blog := LoadBlog(dir, opts)
 	if blog == nil {
 		fmt.Printf("Error during blog load\n")
 		return
@@ -184,6 +206,7 @@ func build_blog(args []string) {
 		fmt.Printf("Build blog succesfully\n")
 	}
 
+	blog.PrintSchedule()
 }
 
 func clean_blog(args []string) {
@@ -194,23 +217,86 @@ func clean_blog(args []string) {
 		return
 	}
 	dir := checkDirPath(pwd)
-	if err = os.RemoveAll(dir + "tags"); err != nil {
+	info, err := LoadBlogInfo(dir)
+	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	os.Mkdir(dir+"/tags", 0755)
-	if err = os.RemoveAll(dir + "html"); err != nil {
+	pd, err := publishDir(dir, info)
+	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	os.Mkdir(dir+"/html", 0755)
-	if err = os.Remove(dir + "index.html"); err != nil {
+	if err = os.RemoveAll(pd); err != nil {
 		fmt.Println(err)
 		return
 	}
+	os.Remove(dir + MANIFEST_FILE)
 	fmt.Printf("Clean blog succesfully\n")
 }
 
+func gen_css_style(args []string) {
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Current directory is not Grom blog\n")
+		return
+	}
+	dir := checkDirPath(pwd)
+	info, err := LoadBlogInfo(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	opts, err := loadHighlightOptions(info)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if len(args) > 1 {
+		opts.Style = args[1]
+	}
+
+	file := dir + "themes/" + info["Theme"] + "/" + HIGHLIGHT_CSS_FILE
+	f, err := os.Create(file)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer f.Close()
+	err = writeHighlightCSS(f, opts)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Style %s written in %s\n", opts.Style, file)
+}
+
+func rename_post(args []string) {
+
+	if len(args) < 3 {
+		fmt.Printf("grom rename <old-id> <new-id>\n")
+		return
+	}
+
+	pwd, _ := os.Getwd()
+	dir := checkDirPath(pwd)
+
+	// drafts and scheduled posts can be renamed and linked too
+	blog := LoadBlog(dir, BuildOptions{Drafts: true, Future: true})
+	if blog == nil {
+		fmt.Printf("Error during blog load\n")
+		return
+	}
+
+	err := blog.Rename(args[1], args[2])
+	if err != nil {
+		fmt.Printf("Post not renamed: %s\n", err.Error())
+	} else {
+		fmt.Printf("Post renamed. Build the blog again to publish it\n")
+	}
+}
+
 func help(args []string) {
 	fmt.Printf("%s\n", HELP)
 }
@@ -252,6 +338,12 @@ func main() {
 	case "clean":
 		clean_blog(args)
 
+	case "rename":
+		rename_post(args)
+
+	case "gen-css-style":
+		gen_css_style(args)
+
 	default:
 		help(args)
 	}
@@ -0,0 +1,157 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+)
+
+/*
+ Syntax highlighting of the code blocks at build time. The code is
+ tokenized by chroma and written with CSS classes, so the colors come
+ from the stylesheet written by grom gen-css-style.
+
+ A fenced block can change the line numbers and highlight some lines:
+
+    ```go {linenos=true hl_lines=2,4-6}
+*/
+
+const (
+	DEFAULT_HIGHLIGHT_STYLE = "github"
+	HIGHLIGHT_CSS_FILE      = "highlight.css"
+)
+
+type highlightOptions struct {
+	Style       string
+	LineNumbers bool
+	Lines       [][2]int
+}
+
+func loadHighlightOptions(info BlogInfo) (highlightOptions, error) {
+	opts := highlightOptions{Style: DEFAULT_HIGHLIGHT_STYLE}
+	if s, ok := info["HighlightStyle"]; ok && s != "" {
+		if _, ok := styles.Registry[s]; !ok {
+			return opts, errors.New("Unknown HighlightStyle " + s)
+		}
+		opts.Style = s
+	}
+	if n, ok := info["HighlightLineNumbers"]; ok {
+		b, err := strconv.ParseBool(n)
+		if err != nil {
+			return opts, errors.New("Bad value for HighlightLineNumbers defined in config.json")
+		}
+		opts.LineNumbers = b
+	}
+	return opts, nil
+}
+
+// parseCodeInfo reads the info string of a fenced block, like
+// "go {linenos=true hl_lines=2,4-6}", and returns its language and
+// its options, starting from the ones of the blog.
+func parseCodeInfo(info string, opts highlightOptions) (string, highlightOptions) {
+	info = strings.TrimSpace(info)
+	lang := info
+	if i := strings.IndexAny(info, " \t{"); i >= 0 {
+		lang, info = info[:i], info[i:]
+	} else {
+		info = ""
+	}
+	info = strings.Trim(strings.TrimSpace(info), "{}")
+
+	for _, field := range strings.Fields(strings.Replace(info, ", ", ",", -1)) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "linenos":
+			opts.LineNumbers, _ = strconv.ParseBool(kv[1])
+		case "hl_lines":
+			opts.Lines = parseLineRanges(strings.Trim(kv[1], `[]"`))
+		}
+	}
+	return lang, opts
+}
+
+// parseLineRanges reads a list of lines like 2,4-6.
+func parseLineRanges(s string) [][2]int {
+	ranges := make([][2]int, 0)
+	for _, r := range strings.Split(s, ",") {
+		bounds := strings.SplitN(strings.Trim(r, `" `), "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			continue
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(bounds[1]); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges
+}
+
+func (opts highlightOptions) formatter() *html.Formatter {
+	return html.New(html.WithClasses(true),
+		html.WithLineNumbers(opts.LineNumbers),
+		html.HighlightLines(opts.Lines))
+}
+
+// highlightCode writes the code highlighted for its language. It
+// returns false, writing nothing, when there is no lexer for it.
+func highlightCode(out *bytes.Buffer, code string, lang string, opts highlightOptions) bool {
+	lexer := lexers.Get(lang)
+	if lang == "" || lexer == nil {
+		return false
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return false
+	}
+
+	var b bytes.Buffer
+	err = opts.formatter().Format(&b, styles.Get(opts.Style), iterator)
+	if err != nil {
+		return false
+	}
+	out.Write(b.Bytes())
+	return true
+}
+
+// writeHighlightCSS writes the stylesheet of a highlighting style.
+func writeHighlightCSS(w io.Writer, opts highlightOptions) error {
+	style, ok := styles.Registry[opts.Style]
+	if !ok {
+		return errors.New("Unknown style " + opts.Style)
+	}
+	return opts.formatter().WriteCSS(w, style)
+}
@@ -0,0 +1,139 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+ Wiki links between posts. [[post-id]] and [[post-id|text]] link to the
+ post or static page with that id, so the sources do not depend on the
+ URLs of the blog. Links inside code are left untouched.
+*/
+
+var (
+	wikiLinkReg  = regexp.MustCompile(`\[\[([\w.-]+)(?:\|([^\]\n]+))?\]\]`)
+	codeFenceReg = regexp.MustCompile(`(?i)^\s*(` + "```" + `|~~~|#\+BEGIN_|#\+END_)`)
+)
+
+// resolveLinks replaces the wiki links of every post and static page
+// and sets their Backlinks. Links to posts that are not published,
+// like drafts or scheduled posts, are left as text until they are.
+// Links to unknown ids fail the build.
+func (blog *Blog) resolveLinks() error {
+	all := append(append(Articles{}, blog.Posts...), blog.Statics...)
+	ids := make(map[string]*Article, len(all)+len(blog.unpublished))
+	for _, a := range blog.unpublished {
+		ids[a.Id] = a
+	}
+	for _, a := range all {
+		ids[a.Id] = a
+		a.Backlinks = nil
+	}
+
+	failed := make(buildErrors, 0)
+	for _, a := range all {
+		content, links, err := a.resolveLinks(blog, ids)
+		if err != nil {
+			failed = append(failed, errors.New(a.File+": "+err.Error()))
+			continue
+		}
+		a.Content = content
+		a.links = links
+		for _, t := range links {
+			if t != a && !t.Backlinks.contains(a) {
+				t.Backlinks = append(t.Backlinks, a)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+func (a *Article) resolveLinks(blog *Blog, ids map[string]*Article) ([]byte, Articles, error) {
+	links := make(Articles, 0)
+	var unknown []string
+
+	code := false
+	lines := bytes.SplitAfter(a.Content, []byte("\n"))
+	for i, l := range lines {
+		if codeFenceReg.Match(l) {
+			code = !code
+			continue
+		}
+		if code || !bytes.Contains(l, []byte("[[")) {
+			continue
+		}
+
+		// the odd parts are inline code
+		parts := bytes.Split(l, []byte("`"))
+		for p := 0; p < len(parts); p += 2 {
+			parts[p] = wikiLinkReg.ReplaceAllFunc(parts[p], func(m []byte) []byte {
+				sub := wikiLinkReg.FindSubmatch(m)
+				t, ok := ids[string(sub[1])]
+				if !ok {
+					// [[file.org]] is an Org-mode link
+					if !bytes.Contains(sub[1], []byte(".")) {
+						unknown = append(unknown, string(sub[1]))
+					}
+					return m
+				}
+				text := t.Title
+				if len(sub[2]) > 0 {
+					text = strings.TrimSpace(string(sub[2]))
+				}
+				if blog.unpublished.contains(t) {
+					fmt.Printf("%s: %s is not published, linked as text\n", a.File, t.Id)
+					return []byte(text)
+				}
+				if !links.contains(t) {
+					links = append(links, t)
+				}
+				if isOrgFile(a.File) {
+					return []byte("[[" + t.URL() + "][" + text + "]]")
+				}
+				return []byte("[" + text + "](" + t.URL() + ")")
+			})
+		}
+		lines[i] = bytes.Join(parts, []byte("`"))
+	}
+
+	if len(unknown) > 0 {
+		return nil, nil, errors.New("Unknown post in links: " + strings.Join(unknown, ", "))
+	}
+	return bytes.Join(lines, nil), links, nil
+}
+
+func (articles Articles) contains(a *Article) bool {
+	for _, b := range articles {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,280 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ Incremental builds. Every generated file is recorded in the build
+ manifest with a key that hashes all the inputs used to render it. A
+ file is only rendered again when its key changes or when it has been
+ removed.
+*/
+
+const MANIFEST_FILE = ".grom-manifest.json"
+
+type buildManifest struct {
+	Config    string
+	Templates map[string]string
+	Sources   map[string]string
+	Outputs   map[string]string
+
+	out      siteOutput // where the files and the manifest are saved
+	previous map[string]string
+	failed   map[string]bool
+	built    int
+	skipped  int
+	mutex    sync.Mutex // pages are built concurrently
+}
+
+func hashOf(parts ...string) string {
+	h := sha1.New()
+	for _, p := range parts {
+		io.WriteString(h, p)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadManifest reads the manifest of the last build. A missing or
+// corrupted manifest just means that every file is rendered again.
+func loadManifest(out siteOutput) *buildManifest {
+	m := new(buildManifest)
+	if b, err := out.ReadManifest(); err == nil {
+		if err = json.Unmarshal(b, m); err != nil {
+			fmt.Println("Ignoring corrupted " + MANIFEST_FILE)
+		}
+	}
+	m.out = out
+	m.previous = m.Outputs
+	if m.previous == nil {
+		m.previous = make(map[string]string)
+	}
+	m.Templates = make(map[string]string)
+	m.Sources = make(map[string]string)
+	m.Outputs = make(map[string]string)
+	m.failed = make(map[string]bool)
+	return m
+}
+
+func (m *buildManifest) save() error {
+	b, err := json.MarshalIndent(m, "", " ")
+	if err != nil {
+		return err
+	}
+	return m.out.WriteManifest(b)
+}
+
+// upToDate tells if file was generated with the same key in the last
+// build and it is still there. The file is recorded for this build
+// anyway, and a file recorded twice is an error, since one would
+// replace the other. Files are relative to the root of the site.
+func (m *buildManifest) upToDate(file string, key string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.Outputs[file]; ok {
+		return false, errors.New(file + " is generated twice")
+	}
+	m.Outputs[file] = key
+	if m.previous[file] != key {
+		return false, nil
+	}
+	ok := m.out.Exists(file)
+	if ok {
+		m.skipped++
+	}
+	return ok, nil
+}
+
+// has tells if file is already an output of this build.
+func (m *buildManifest) has(file string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, ok := m.Outputs[file]
+	return ok
+}
+
+// done records the result of writing a file.
+func (m *buildManifest) done(file string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err != nil {
+		// a broken file must not look up to date in the next build
+		delete(m.Outputs, file)
+		m.failed[file] = true
+		m.out.Remove(file)
+		return
+	}
+	m.built++
+}
+
+// keepUnbuilt records again the files of the last build that were not
+// visited by a failed build, since they are still there untouched.
+func (m *buildManifest) keepUnbuilt() {
+	for file, key := range m.previous {
+		if _, ok := m.Outputs[file]; !ok && !m.failed[file] {
+			m.Outputs[file] = key
+		}
+	}
+}
+
+// removeStale deletes the files generated by the last build that are
+// not generated anymore, like the page of a deleted post or of a tag
+// without posts.
+func (m *buildManifest) removeStale() {
+	for file := range m.previous {
+		if _, ok := m.Outputs[file]; !ok {
+			m.out.Remove(file)
+		}
+	}
+}
+
+/*
+   Keys of the blog inputs
+*/
+
+// makeSiteKey hashes the inputs shared by every page: the config, the
+// build options, the theme, the static pages linked from main.html and
+// the list of posts.
+func (blog *Blog) makeSiteKey() (string, error) {
+	m := blog.manifest
+
+	info, err := json.Marshal(blog.Info)
+	if err != nil {
+		return "", err
+	}
+	m.Config = hashOf(string(info), fmt.Sprintf("%+v", blog.Options))
+
+	files, err := filepath.Glob(blog.ThemeDir + "/*.html")
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+	parts := []string{m.Config}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		name := strings.TrimPrefix(f, blog.Dir)
+		m.Templates[name] = hashOf(string(b))
+		parts = append(parts, name, m.Templates[name])
+	}
+
+	for _, a := range blog.Posts {
+		m.Sources[strings.TrimPrefix(a.File, blog.Dir)] = a.hash
+	}
+	for _, a := range blog.Statics {
+		m.Sources[strings.TrimPrefix(a.File, blog.Dir)] = a.hash
+		parts = append(parts, a.Id, a.Title)
+	}
+	// every page can show the lists of the blog, like the last posts
+	// or the tags with their number of posts
+	parts = append(parts, listKey(blog.Posts))
+
+	return hashOf(parts...), nil
+}
+
+// listKey hashes the fields shown by the pages that list posts, like
+// the archive or the tag pages.
+func listKey(posts Articles) string {
+	parts := make([]string, 0, len(posts)*4)
+	for _, a := range posts {
+		parts = append(parts, a.Id, a.Title, a.Date.Format(time.RFC3339),
+			strings.Join(a.GetTags(), ","))
+	}
+	return hashOf(parts...)
+}
+
+// contentKey hashes the whole sources of the posts and the posts they
+// link, for the pages that show their content, like the index or the
+// feeds.
+func contentKey(posts Articles) string {
+	parts := make([]string, 0, len(posts)*2)
+	for _, a := range posts {
+		parts = append(parts, a.hash, listKey(a.links))
+	}
+	return hashOf(parts...)
+}
+
+// buildFile writes file with write unless it is up to date for key.
+// The file is relative to the publish directory. It is safe to call it
+// from several goroutines.
+func (blog *Blog) buildFile(file string, key string, write func(io.Writer) error) error {
+	return blog.writeOutput(file, hashOf(blog.siteKey, key), write)
+}
+
+// publishFile copies a source file, like an image or a theme
+// stylesheet, to the publish directory. Its key does not depend on
+// the site, so it is only copied again when it changes.
+func (blog *Blog) publishFile(src string, file string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	key := hashOf("copy", src, fmt.Sprint(fi.Size()), fi.ModTime().String())
+	return blog.writeOutput(file, key, func(w io.Writer) error {
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(w, in)
+		return err
+	})
+}
+
+func (blog *Blog) writeOutput(file string, key string, write func(io.Writer) error) error {
+	m := blog.manifest
+	ok, err := m.upToDate(file, key)
+	if ok || err != nil {
+		return err
+	}
+
+	f, err := m.out.Create(file)
+	if err != nil {
+		m.done(file, err)
+		return err
+	}
+
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	m.done(file, err)
+	return err
+}
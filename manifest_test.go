@@ -0,0 +1,105 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// copySample copies the sample blog to a temporary directory.
+func copySample(t *testing.T) string {
+	dir := t.TempDir() + "/"
+	err := filepath.Walk("sample-blog/", func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel("sample-blog/", p)
+		if fi.IsDir() {
+			return os.MkdirAll(dir+rel, 0755)
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dir+rel, b, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writePost(t *testing.T, dir string, id string, date string) {
+	post := "---\ntitle: " + id + "\nid: " + id + "\ndate: " + date + "\n---\ntext\n"
+	if err := ioutil.WriteFile(dir+"post/"+id+".md", []byte(post), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func buildIn(t *testing.T, dir string, out *memOutput) *Blog {
+	blog := LoadBlog(dir, BuildOptions{})
+	if blog == nil {
+		t.Fatal("Error during blog load")
+	}
+	blog.output = out
+	if err := blog.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return blog
+}
+
+// TestNewPostRebuildsPages checks that publishing a post builds again
+// the pages of the other posts, even of those that are not next to it,
+// since the theme can list the posts.
+func TestNewPostRebuildsPages(t *testing.T) {
+	dir := copySample(t)
+	writePost(t, dir, "a", "2014-01-01")
+	writePost(t, dir, "b", "2015-01-01")
+	out := newMemOutput()
+	blog := buildIn(t, dir, out)
+	old := blog.Posts[len(blog.Posts)-1]
+	before := out.files[old.file()]
+
+	blog = buildIn(t, dir, out)
+	if blog.manifest.built != 0 {
+		t.Errorf("%d files built again without changes", blog.manifest.built)
+	}
+
+	writePost(t, dir, "new", "2020-01-01")
+	buildIn(t, dir, out)
+	after := out.files[old.file()]
+	if after.modTime.Equal(before.modTime) {
+		t.Errorf("%s was not built again", old.file())
+	}
+}
+
+func TestOutputGeneratedTwice(t *testing.T) {
+	m := loadManifest(newMemOutput())
+	if _, err := m.upToDate("rss.xml", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.upToDate("rss.xml", "b"); err == nil {
+		t.Error("rss.xml is generated twice without an error")
+	}
+}
@@ -0,0 +1,227 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ Article metadata. It is read from a YAML (---) or TOML (+++) front
+ matter, from an Org-mode property drawer or from the legacy
+ <!--- :Key: value --> comment block.
+*/
+
+// Meta keeps the typed values of the article properties. Keys are
+// stored with their first letter in upper case, so "tags" in a front
+// matter and ":Tags:" in a legacy block are the same key and templates
+// can use {{.Meta.Tags}} for both.
+type Meta map[string]interface{}
+
+var (
+	yamlDelim = []byte("---")
+	tomlDelim = []byte("+++")
+
+	legacyBlockReg = regexp.MustCompile(`(?s)<!---?(.*?)-->`)
+	legacyPropReg  = regexp.MustCompile(`(?m)^\s*:([\w-]+):[ \t]*(.*?)\s*$`)
+)
+
+var metaDateFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func canonicalMetaKey(key string) string {
+	if key == "" {
+		return key
+	}
+	return strings.ToUpper(key[:1]) + key[1:]
+}
+
+// Set stores a value normalizing its key and its type: lists become
+// []string. Strings are kept as they are, even if they look like a
+// date, since only Time reads them as dates.
+func (m Meta) Set(key string, value interface{}) {
+	m[canonicalMetaKey(key)] = normalizeMetaValue(value)
+}
+
+func (m Meta) Has(key string) bool {
+	_, ok := m[canonicalMetaKey(key)]
+	return ok
+}
+
+// String returns the value of a key as text. It returns an empty
+// string for missing keys.
+func (m Meta) String(key string) string {
+	switch v := m[canonicalMetaKey(key)].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ", ")
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (m Meta) Bool(key string) bool {
+	switch v := m[canonicalMetaKey(key)].(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(strings.TrimSpace(v))
+		return b
+	}
+	return false
+}
+
+// List returns the value of a key as a list. Plain strings are split
+// by commas, as the legacy Tags property.
+func (m Meta) List(key string) []string {
+	switch v := m[canonicalMetaKey(key)].(type) {
+	case []string:
+		return v
+	case string:
+		list := make([]string, 0)
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		return list
+	case nil:
+		return []string{}
+	default:
+		return []string{m.String(key)}
+	}
+}
+
+// Time returns the value of a key as a date. Strings are parsed with
+// parseDate, so the Org-mode <2013-05-16 Thu> dates are accepted too,
+// and the ones without a time zone are in loc.
+func (m Meta) Time(key string, loc *time.Location) (time.Time, error) {
+	switch v := m[canonicalMetaKey(key)].(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		return parseDate(v, loc)
+	}
+	return time.Time{}, errors.New("No date in " + key)
+}
+
+func normalizeMetaValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for i := range v {
+			list = append(list, fmt.Sprint(normalizeMetaValue(v[i])))
+		}
+		return list
+	case map[interface{}]interface{}:
+		sub := make(Meta)
+		for k, e := range v {
+			sub.Set(fmt.Sprint(k), e)
+		}
+		return sub
+	case map[string]interface{}:
+		sub := make(Meta)
+		for k, e := range v {
+			sub.Set(k, e)
+		}
+		return sub
+	}
+	return value
+}
+
+// splitFrontMatter returns the front matter of the content, its
+// delimiter and the rest of the file. The front matter is empty when
+// the file has none.
+func splitFrontMatter(content []byte) ([]byte, []byte, []byte) {
+	for _, delim := range [][]byte{yamlDelim, tomlDelim} {
+		lines := bytes.SplitAfter(content, []byte("\n"))
+		if !bytes.Equal(bytes.TrimSpace(lines[0]), delim) {
+			continue
+		}
+		n := len(lines[0])
+		for _, l := range lines[1:] {
+			if bytes.Equal(bytes.TrimSpace(l), delim) {
+				return content[len(lines[0]):n], delim, content[n+len(l):]
+			}
+			n += len(l)
+		}
+	}
+	return nil, nil, content
+}
+
+// parseFrontMatter reads the YAML or TOML front matter of a file and
+// returns its properties and the content without it.
+func parseFrontMatter(content []byte) (Meta, []byte, error) {
+	fm, delim, body := splitFrontMatter(content)
+	if delim == nil {
+		return nil, content, nil
+	}
+
+	values := make(map[string]interface{})
+	var err error
+	if bytes.Equal(delim, yamlDelim) {
+		err = yaml.Unmarshal(fm, &values)
+	} else {
+		_, err = toml.Decode(string(fm), &values)
+	}
+	if err != nil {
+		return nil, nil, errors.New("Bad front matter: " + err.Error())
+	}
+
+	meta := make(Meta)
+	for k, v := range values {
+		meta.Set(k, v)
+	}
+	return meta, body, nil
+}
+
+// parseLegacyProperties reads every :Key: value line of the HTML
+// comment block used by the first versions of grom. Files without the
+// block are scanned entirely, as parseProperty did.
+func parseLegacyProperties(content []byte) Meta {
+	meta := make(Meta)
+	if block := legacyBlockReg.FindSubmatch(content); block != nil {
+		content = block[1]
+	}
+	for _, p := range legacyPropReg.FindAllSubmatch(content, -1) {
+		meta.Set(string(p[1]), string(p[2]))
+	}
+	return meta
+}
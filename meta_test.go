@@ -0,0 +1,106 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name, src, fm, delim, body string
+	}{
+		{"yaml", "---\ntitle: A\n---\nbody\n", "title: A\n", "---", "body\n"},
+		{"toml", "+++\ntitle = \"A\"\n+++\nbody\n", "title = \"A\"\n", "+++", "body\n"},
+		{"crlf", "---\r\ntitle: A\r\n---\r\nbody", "title: A\r\n", "---", "body"},
+		{"empty", "---\n---\nbody", "", "---", "body"},
+		{"none", "# A\nbody\n", "", "", "# A\nbody\n"},
+		{"unclosed", "---\ntitle: A\nbody\n", "", "", "---\ntitle: A\nbody\n"},
+		{"rule in body", "# A\n\n---\n", "", "", "# A\n\n---\n"},
+	}
+	for _, test := range tests {
+		fm, delim, body := splitFrontMatter([]byte(test.src))
+		if string(fm) != test.fm || string(delim) != test.delim || string(body) != test.body {
+			t.Errorf("%s: got %q %q %q", test.name, fm, delim, body)
+		}
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	for _, src := range []string{
+		"---\ntitle: A\ndate: 2020-01-05 10:00\ntags: [go, web]\ndraft: true\n---\nbody",
+		"+++\ntitle = \"A\"\ndate = \"2020-01-05 10:00\"\ntags = [\"go\", \"web\"]\ndraft = true\n+++\nbody",
+	} {
+		meta, body, err := parseFrontMatter([]byte(src))
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+		if string(body) != "body" {
+			t.Errorf("%q: body %q", src, body)
+		}
+		if meta.String("Title") != "A" || !meta.Bool("Draft") {
+			t.Errorf("%q: meta %v", src, meta)
+		}
+		if tags := meta.List("tags"); !reflect.DeepEqual(tags, []string{"go", "web"}) {
+			t.Errorf("%q: tags %v", src, tags)
+		}
+		date, err := meta.Time("Date", time.Local)
+		want := time.Date(2020, 1, 5, 10, 0, 0, 0, time.Local)
+		if err != nil || !date.Equal(want) {
+			t.Errorf("%q: date %v %v", src, date, err)
+		}
+	}
+
+	if _, _, err := parseFrontMatter([]byte("---\ntitle: [oops\n---\n")); err == nil {
+		t.Error("no error for a bad front matter")
+	}
+}
+
+func TestMetaDateStrings(t *testing.T) {
+	meta, _, err := parseFrontMatter([]byte("---\ntitle: \"2020-01-01\"\nid: 2020-01-01\ndate: 2020-01-01\n---\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"Title", "Id"} {
+		if s := meta.String(key); s != "2020-01-01" {
+			t.Errorf("%s is %q", key, s)
+		}
+	}
+	if _, err := meta.Time("Date", time.Local); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseLegacyProperties(t *testing.T) {
+	meta := parseLegacyProperties([]byte("# A\n<!---\n:Id: a\n:Tags: go, web\n:Date: <2013-05-16 Thu>\n-->\nbody :Id: b\n"))
+	if meta.String("Id") != "a" {
+		t.Errorf("id %q", meta.String("Id"))
+	}
+	if tags := meta.List("Tags"); !reflect.DeepEqual(tags, []string{"go", "web"}) {
+		t.Errorf("tags %v", tags)
+	}
+	if _, err := meta.Time("Date", time.Local); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,516 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/*
+ Org-mode support. Grom renders the subset of Org syntax used by the
+ posts: headings, lists, emphasis, links, images, blocks, tables and
+ property drawers.
+*/
+
+var (
+	orgHeadingReg  = regexp.MustCompile(`^(\*+)\s+(.*?)\s*$`)
+	orgHeadTagsReg = regexp.MustCompile(`\s+(:[\w@#%:]+:)\s*$`)
+	orgTitleReg    = regexp.MustCompile(`(?im)^#\+TITLE:\s*(.+?)\s*$`)
+	orgDrawerReg   = regexp.MustCompile(`^\s*:([\w-]+):\s*$`)
+	orgPropReg     = regexp.MustCompile(`^\s*:([\w-]+):\s*(.*?)\s*$`)
+	orgBlockReg    = regexp.MustCompile(`(?i)^\s*#\+BEGIN_(\w+)\s*(.*?)\s*$`)
+	orgListReg     = regexp.MustCompile(`^(\s*)([-+]|\d+[.)]|\s\*)\s+(.*)$`)
+	orgRuleReg     = regexp.MustCompile(`^\s*-{5,}\s*$`)
+	orgTableSepReg = regexp.MustCompile(`^\s*\|[-+]+\|?\s*$`)
+	orgLinkReg     = regexp.MustCompile(`\[\[([^\]]+)\](?:\[([^\]]+)\])?\]`)
+	orgVerbReg     = regexp.MustCompile(`(^|[\s({'"])([=~])([^\s=~](?:[^=~]*?[^\s=~])?)([=~])($|[\s\-.,:!?;'")}\]])`)
+	orgImageReg    = regexp.MustCompile(`(?i)\.(jpe?g|png|gif|svg)$`)
+)
+
+var orgEmphasis = []struct {
+	reg *regexp.Regexp
+	tag string
+}{
+	{orgEmphasisReg(`\*`), "strong"},
+	{orgEmphasisReg(`/`), "em"},
+	{orgEmphasisReg(`_`), "u"},
+	{orgEmphasisReg(`\+`), "del"},
+}
+
+func orgEmphasisReg(m string) *regexp.Regexp {
+	return regexp.MustCompile(`(^|[\s({'"\x00])` + m + `([^\s` + m + `](?:[^` + m + `]*?[^\s` + m + `])?)` +
+		m + `($|[\s\-.,:!?;'")}\]\x00])`)
+}
+
+type orgRenderer struct {
+	lines []string
+	pos   int
+	url   string
+	out   bytes.Buffer
+	title bool
+	opts  highlightOptions // highlighting of the blog
+}
+
+func isOrgFile(file string) bool {
+	return strings.ToLower(filepath.Ext(file)) == ".org"
+}
+
+// Org2HTML renders the Org-mode content of a post. With skipTitle, the
+// first level-1 heading is the article title and it is not included in
+// the output, like the "# Title" line of the Markdown sources.
+func Org2HTML(content []byte, url string, skipTitle bool, opts highlightOptions) string {
+	r := &orgRenderer{
+		lines: strings.Split(strings.Replace(string(content), "\r\n", "\n", -1), "\n"),
+		url:   url,
+		title: !skipTitle,
+		opts:  opts,
+	}
+	r.render()
+	return r.out.String()
+}
+
+func parseOrgTitle(content []byte) string {
+	if m := orgTitleReg.FindSubmatch(content); m != nil {
+		return string(m[1])
+	}
+	for _, l := range strings.Split(string(content), "\n") {
+		m := orgHeadingReg.FindStringSubmatch(l)
+		if m != nil && len(m[1]) == 1 {
+			return orgHeadTagsReg.ReplaceAllString(m[2], "")
+		}
+	}
+	return ""
+}
+
+// parseOrgProperties returns the keys of the first property drawer of
+// the file. Tags set on the title heading are used when the drawer
+// has no Tags property.
+func parseOrgProperties(content []byte) Meta {
+	props := make(Meta)
+	lines := strings.Split(string(content), "\n")
+	inDrawer := false
+	for _, l := range lines {
+		if !inDrawer {
+			if strings.EqualFold(strings.TrimSpace(l), ":PROPERTIES:") {
+				inDrawer = true
+			}
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(l), ":END:") {
+			break
+		}
+		if m := orgPropReg.FindStringSubmatch(l); m != nil {
+			props.Set(m[1], m[2])
+		}
+	}
+
+	if !props.Has("Tags") {
+		for _, l := range lines {
+			m := orgHeadingReg.FindStringSubmatch(l)
+			if m == nil || len(m[1]) != 1 {
+				continue
+			}
+			if t := orgHeadTagsReg.FindStringSubmatch(m[2]); t != nil {
+				tags := strings.Split(strings.Trim(t[1], ":"), ":")
+				props.Set("Tags", tags)
+			}
+			break
+		}
+	}
+	return props
+}
+
+/*
+   Block level
+*/
+
+func (r *orgRenderer) render() {
+	for r.pos < len(r.lines) {
+		l := r.lines[r.pos]
+		switch {
+		case strings.TrimSpace(l) == "":
+			r.pos++
+		case orgHeadingReg.MatchString(l):
+			r.heading()
+		case r.isDrawer(r.pos):
+			r.drawer()
+		case orgBlockReg.MatchString(l):
+			r.block()
+		case strings.HasPrefix(strings.TrimSpace(l), "#"):
+			// keywords and comments
+			r.pos++
+		case strings.HasPrefix(strings.TrimSpace(l), "|"):
+			r.table()
+		case orgRuleReg.MatchString(l):
+			r.out.WriteString("<hr/>\n")
+			r.pos++
+		case orgListReg.MatchString(l):
+			r.list(indentOf(l))
+		default:
+			r.paragraph()
+		}
+	}
+}
+
+func (r *orgRenderer) heading() {
+	m := orgHeadingReg.FindStringSubmatch(r.lines[r.pos])
+	r.pos++
+	level := len(m[1])
+	if level == 1 && !r.title {
+		r.title = true
+		return
+	}
+	if level > 6 {
+		level = 6
+	}
+	text := orgHeadTagsReg.ReplaceAllString(m[2], "")
+	fmt.Fprintf(&r.out, "<h%d>%s</h%d>\n", level, r.inline(text), level)
+}
+
+// isDrawer tells if the line i starts a drawer, closed by an :END:
+// line before the next heading. Other :word: lines are text.
+func (r *orgRenderer) isDrawer(i int) bool {
+	if !orgDrawerReg.MatchString(r.lines[i]) {
+		return false
+	}
+	for _, l := range r.lines[i+1:] {
+		if strings.EqualFold(strings.TrimSpace(l), ":END:") {
+			return true
+		}
+		if orgHeadingReg.MatchString(l) {
+			return false
+		}
+	}
+	return false
+}
+
+func (r *orgRenderer) drawer() {
+	for r.pos < len(r.lines) {
+		l := strings.TrimSpace(r.lines[r.pos])
+		r.pos++
+		if strings.EqualFold(l, ":END:") {
+			return
+		}
+	}
+}
+
+func (r *orgRenderer) block() {
+	m := orgBlockReg.FindStringSubmatch(r.lines[r.pos])
+	r.pos++
+	kind := strings.ToUpper(m[1])
+	end := "#+END_" + kind
+
+	body := make([]string, 0)
+	for r.pos < len(r.lines) {
+		l := r.lines[r.pos]
+		r.pos++
+		if strings.EqualFold(strings.TrimSpace(l), end) {
+			break
+		}
+		body = append(body, l)
+	}
+	body = unindent(body)
+
+	switch kind {
+	case "SRC":
+		lang := strings.Fields(m[2])
+		opts := r.opts
+		for _, sw := range lang {
+			if sw == "-n" || sw == "+n" {
+				opts.LineNumbers = true
+			}
+		}
+		if len(lang) > 0 && highlightCode(&r.out, strings.Join(body, "\n")+"\n", lang[0], opts) {
+			break
+		}
+		code := html.EscapeString(strings.Join(body, "\n")) + "\n"
+		if len(lang) > 0 {
+			fmt.Fprintf(&r.out, "<pre><code class=\"language-%s\">%s</code></pre>\n",
+				html.EscapeString(lang[0]), code)
+		} else {
+			fmt.Fprintf(&r.out, "<pre><code>%s</code></pre>\n", code)
+		}
+	case "EXAMPLE":
+		fmt.Fprintf(&r.out, "<pre>%s\n</pre>\n", html.EscapeString(strings.Join(body, "\n")))
+	case "QUOTE", "CENTER", "VERSE":
+		sub := &orgRenderer{lines: body, url: r.url, title: true, opts: r.opts}
+		sub.render()
+		tag := "blockquote"
+		if kind == "CENTER" {
+			tag = "div style=\"text-align:center\""
+		}
+		fmt.Fprintf(&r.out, "<%s>\n%s</%s>\n", tag, sub.out.String(), strings.Fields(tag)[0])
+	case "HTML", "EXPORT":
+		if kind == "HTML" || strings.EqualFold(strings.TrimSpace(m[2]), "html") {
+			r.out.WriteString(strings.Join(body, "\n") + "\n")
+		}
+	default:
+		fmt.Fprintf(&r.out, "<pre>%s\n</pre>\n", html.EscapeString(strings.Join(body, "\n")))
+	}
+}
+
+func (r *orgRenderer) table() {
+	rows := make([][]string, 0)
+	header := -1
+	for r.pos < len(r.lines) {
+		l := strings.TrimSpace(r.lines[r.pos])
+		if !strings.HasPrefix(l, "|") {
+			break
+		}
+		r.pos++
+		if orgTableSepReg.MatchString(l) {
+			if header < 0 && len(rows) > 0 {
+				header = len(rows)
+			}
+			continue
+		}
+		l = strings.TrimSuffix(strings.TrimPrefix(l, "|"), "|")
+		cells := strings.Split(l, "|")
+		for i := range cells {
+			cells[i] = strings.TrimSpace(cells[i])
+		}
+		rows = append(rows, cells)
+	}
+
+	r.out.WriteString("<table>\n")
+	for i, row := range rows {
+		if i == 0 && header > 0 {
+			r.out.WriteString("<thead>\n")
+		}
+		if i == header {
+			r.out.WriteString("<tbody>\n")
+		}
+		cell := "td"
+		if i < header {
+			cell = "th"
+		}
+		r.out.WriteString("<tr>")
+		for _, c := range row {
+			fmt.Fprintf(&r.out, "<%s>%s</%s>", cell, r.inline(c), cell)
+		}
+		r.out.WriteString("</tr>\n")
+		if i == header-1 {
+			r.out.WriteString("</thead>\n")
+		}
+	}
+	if header > 0 && header < len(rows) {
+		r.out.WriteString("</tbody>\n")
+	}
+	r.out.WriteString("</table>\n")
+}
+
+func (r *orgRenderer) list(indent int) {
+	m := orgListReg.FindStringSubmatch(r.lines[r.pos])
+	tag := "ul"
+	if m[2][0] >= '0' && m[2][0] <= '9' {
+		tag = "ol"
+	}
+
+	fmt.Fprintf(&r.out, "<%s>\n", tag)
+	for r.pos < len(r.lines) {
+		l := r.lines[r.pos]
+		m = orgListReg.FindStringSubmatch(l)
+		if m == nil || indentOf(l) != indent {
+			break
+		}
+		r.pos++
+
+		text := []string{m[3]}
+		r.out.WriteString("<li>")
+		for r.pos < len(r.lines) {
+			l = r.lines[r.pos]
+			if strings.TrimSpace(l) == "" {
+				// a blank line only ends the item when the list ends too
+				if r.pos+1 < len(r.lines) && indentOf(r.lines[r.pos+1]) > indent {
+					r.pos++
+					continue
+				}
+				break
+			}
+			if indentOf(l) <= indent {
+				break
+			}
+			if orgListReg.MatchString(l) {
+				r.out.WriteString(r.inline(strings.Join(text, " ")) + "\n")
+				text = text[:0]
+				r.list(indentOf(l))
+				continue
+			}
+			text = append(text, strings.TrimSpace(l))
+			r.pos++
+		}
+		r.out.WriteString(r.inline(strings.Join(text, " ")))
+		r.out.WriteString("</li>\n")
+
+		// skip the blank lines between items of the same list
+		next := r.pos
+		for next < len(r.lines) && strings.TrimSpace(r.lines[next]) == "" {
+			next++
+		}
+		if next < len(r.lines) && indentOf(r.lines[next]) == indent &&
+			orgListReg.MatchString(r.lines[next]) {
+			r.pos = next
+		}
+	}
+	fmt.Fprintf(&r.out, "</%s>\n", tag)
+}
+
+func (r *orgRenderer) paragraph() {
+	text := make([]string, 0)
+	for r.pos < len(r.lines) {
+		l := r.lines[r.pos]
+		t := strings.TrimSpace(l)
+		if t == "" || orgHeadingReg.MatchString(l) || orgBlockReg.MatchString(l) ||
+			r.isDrawer(r.pos) || orgListReg.MatchString(l) ||
+			strings.HasPrefix(t, "|") || strings.HasPrefix(t, "#") {
+			break
+		}
+		if strings.HasSuffix(t, "\\\\") {
+			t = strings.TrimSuffix(t, "\\\\") + "<br/>"
+		}
+		text = append(text, t)
+		r.pos++
+	}
+	fmt.Fprintf(&r.out, "<p>%s</p>\n", r.inline(strings.Join(text, "\n")))
+}
+
+/*
+   Inline level
+*/
+
+// inline renders the emphasis markers and links of a text. Links and
+// verbatim text are replaced by placeholders first so the markers
+// inside them are left untouched.
+func (r *orgRenderer) inline(text string) string {
+	saved := make([]string, 0)
+	save := func(s string) string {
+		saved = append(saved, s)
+		return fmt.Sprintf("\x00%d\x00", len(saved)-1)
+	}
+
+	text = orgLinkReg.ReplaceAllStringFunc(text, func(s string) string {
+		m := orgLinkReg.FindStringSubmatch(s)
+		return save(r.link(m[1], m[2]))
+	})
+	text = orgVerbReg.ReplaceAllStringFunc(text, func(s string) string {
+		m := orgVerbReg.FindStringSubmatch(s)
+		if m[2] != m[4] {
+			return s
+		}
+		return m[1] + save("<code>"+html.EscapeString(m[3])+"</code>") + m[5]
+	})
+	text = r.emphasis(escapeText(text))
+
+	for i := len(saved) - 1; i >= 0; i-- {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), saved[i], 1)
+	}
+	return text
+}
+
+func (r *orgRenderer) emphasis(text string) string {
+	for _, e := range orgEmphasis {
+		for {
+			s := e.reg.ReplaceAllString(text, "$1<"+e.tag+">$2</"+e.tag+">$3")
+			if s == text {
+				break
+			}
+			text = s
+		}
+	}
+	return text
+}
+
+func (r *orgRenderer) link(target string, desc string) string {
+	target = strings.TrimPrefix(target, "file:")
+	src := r.resolve(target)
+
+	if desc == "" {
+		if orgImageReg.MatchString(target) {
+			return r.image(target)
+		}
+		return "<a href='" + html.EscapeString(src) + "'>" + escapeText(target) + "</a>"
+	}
+
+	d := strings.TrimPrefix(desc, "file:")
+	if orgImageReg.MatchString(d) && !strings.Contains(d, " ") {
+		return "<a href='" + html.EscapeString(src) + "'><img src='" +
+			html.EscapeString(r.resolve(d)) + "'/></a>"
+	}
+	return "<a href='" + html.EscapeString(src) + "'>" + r.emphasis(escapeText(desc)) + "</a>"
+}
+
+// image links the thumb of the blog images to the real size image, as
+// the Markdown renderer does with ![img](../img/file).
+func (r *orgRenderer) image(target string) string {
+	if strings.HasPrefix(target, "../img/") {
+		img := strings.TrimPrefix(target, "../img/")
+		return "<a href='" + r.url + "/img/" + img + "'><img src='" +
+			r.url + "/img/thumbs/" + img + "'/></a>"
+	}
+	return "<img src='" + html.EscapeString(r.resolve(target)) + "'/>"
+}
+
+func (r *orgRenderer) resolve(target string) string {
+	if strings.HasPrefix(target, "../") {
+		return r.url + "/" + strings.TrimPrefix(target, "../")
+	}
+	return target
+}
+
+func escapeText(s string) string {
+	s = strings.Replace(s, "&", "&amp;", -1)
+	s = strings.Replace(s, "<br/>", "\x01", -1)
+	s = strings.Replace(s, "<", "&lt;", -1)
+	s = strings.Replace(s, ">", "&gt;", -1)
+	return strings.Replace(s, "\x01", "<br/>", -1)
+}
+
+func indentOf(l string) int {
+	return len(l) - len(strings.TrimLeft(l, " \t"))
+}
+
+func unindent(lines []string) []string {
+	min := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if i := indentOf(l); min < 0 || i < min {
+			min = i
+		}
+	}
+	if min <= 0 {
+		return lines
+	}
+	for i, l := range lines {
+		if len(l) >= min {
+			lines[i] = l[min:]
+		} else {
+			lines[i] = ""
+		}
+	}
+	return lines
+}
@@ -0,0 +1,109 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrg2HTML(t *testing.T) {
+	src := `* Title :go:
+:PROPERTIES:
+:Id: a
+:END:
+Some *bold* /it/ =code= +del+ and [[http://x.com][X]] [[../img/a.jpg]].
+
+** Sub
+- one
+- two
+  1. n
+
+| a | b |
+|---+---|
+| 1 | 2 |
+
+#+BEGIN_SRC
+x < y
+#+END_SRC
+#+BEGIN_QUOTE
+q
+#+END_QUOTE
+`
+	got := Org2HTML([]byte(src), "http://example.com", true, highlightOptions{})
+	for _, want := range []string{
+		"<p>Some <strong>bold</strong> <em>it</em> <code>code</code> <del>del</del> and ",
+		"<a href='http://x.com'>X</a>",
+		"<a href='http://example.com/img/a.jpg'><img src='http://example.com/img/thumbs/a.jpg'/></a>",
+		"<h2>Sub</h2>",
+		"<ul>\n<li>one</li>\n<li>two\n<ol>\n<li>n</li>\n</ol>\n</li>\n</ul>",
+		"<thead>\n<tr><th>a</th><th>b</th></tr>\n</thead>",
+		"<tr><td>1</td><td>2</td></tr>",
+		"<pre><code>x &lt; y\n</code></pre>",
+		"<blockquote>\n<p>q</p>\n</blockquote>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+	for _, bad := range []string{"Title", ":Id:", "PROPERTIES"} {
+		if strings.Contains(got, bad) {
+			t.Errorf("%q in\n%s", bad, got)
+		}
+	}
+}
+
+func TestOrgDrawers(t *testing.T) {
+	tests := []struct{ src, want string }{
+		{":note:\nafter\n", "<p>:note:\nafter</p>\n"},
+		{"before\n:note:\nafter\n", "<p>before\n:note:\nafter</p>\n"},
+		{":LOGBOOK:\nhidden\n:END:\nafter\n", "<p>after</p>\n"},
+		{"text\n:LOGBOOK:\nhidden\n:END:\n", "<p>text</p>\n"},
+		{":note:\n** Sub\n:END:\n", "<p>:note:</p>\n<h2>Sub</h2>\n<p>:END:</p>\n"},
+	}
+	for _, test := range tests {
+		if got := Org2HTML([]byte(test.src), "", false, highlightOptions{}); got != test.want {
+			t.Errorf("Org2HTML(%q) = %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestParseOrgProperties(t *testing.T) {
+	src := "* Title :go:web:\n:PROPERTIES:\n:Id: a\n:Date: <2013-05-16 Thu>\n:END:\ntext\n"
+	meta := parseOrgProperties([]byte(src))
+	if meta.String("Id") != "a" {
+		t.Errorf("id %q", meta.String("Id"))
+	}
+	if tags := meta.List("Tags"); !reflect.DeepEqual(tags, []string{"go", "web"}) {
+		t.Errorf("tags %v", tags)
+	}
+	if _, err := meta.Time("Date", time.Local); err != nil {
+		t.Error(err)
+	}
+	if title := parseOrgTitle([]byte(src)); title != "Title" {
+		t.Errorf("title %q", title)
+	}
+	if title := parseOrgTitle([]byte("#+TITLE: Other\n" + src)); title != "Other" {
+		t.Errorf("title %q", title)
+	}
+}
@@ -0,0 +1,222 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ Outputs of the builds. A site is written to its PublishDir, but the
+ preview of grom serve is kept in memory, so it never touches the site
+ that is going to be deployed.
+*/
+
+// siteOutput stores the files of the site and the manifest of its
+// builds. Files are relative to the root of the site.
+type siteOutput interface {
+	Create(file string) (io.WriteCloser, error)
+	Exists(file string) bool
+	Remove(file string)
+	ReadManifest() ([]byte, error)
+	WriteManifest(b []byte) error
+}
+
+// diskOutput writes the site in a directory.
+type diskOutput struct {
+	dir      string
+	manifest string // the manifest file, out of the site
+}
+
+func (d diskOutput) Create(file string) (io.WriteCloser, error) {
+	err := os.MkdirAll(filepath.Dir(d.dir+file), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return os.Create(d.dir + file)
+}
+
+func (d diskOutput) Exists(file string) bool {
+	_, err := os.Stat(d.dir + file)
+	return err == nil
+}
+
+func (d diskOutput) Remove(file string) {
+	os.Remove(d.dir + file)
+}
+
+func (d diskOutput) ReadManifest() ([]byte, error) {
+	return ioutil.ReadFile(d.manifest)
+}
+
+func (d diskOutput) WriteManifest(b []byte) error {
+	return ioutil.WriteFile(d.manifest, b, 0644)
+}
+
+// memOutput keeps the site in memory. It is an http.FileSystem, so it
+// can be served while the site is built again: a file is only replaced
+// once it has been written entirely.
+type memOutput struct {
+	mutex    sync.RWMutex
+	files    map[string]memEntry
+	manifest []byte
+}
+
+type memEntry struct {
+	data    []byte
+	modTime time.Time
+}
+
+// memWriter buffers a file until it is closed.
+type memWriter struct {
+	bytes.Buffer
+	out  *memOutput
+	file string
+}
+
+func newMemOutput() *memOutput {
+	return &memOutput{files: make(map[string]memEntry)}
+}
+
+func (o *memOutput) Create(file string) (io.WriteCloser, error) {
+	return &memWriter{out: o, file: file}, nil
+}
+
+func (w *memWriter) Close() error {
+	w.out.mutex.Lock()
+	defer w.out.mutex.Unlock()
+	w.out.files[w.file] = memEntry{w.Bytes(), time.Now()}
+	return nil
+}
+
+func (o *memOutput) Exists(file string) bool {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+	_, ok := o.files[file]
+	return ok
+}
+
+func (o *memOutput) Remove(file string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	delete(o.files, file)
+}
+
+func (o *memOutput) ReadManifest() ([]byte, error) {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+	if o.manifest == nil {
+		return nil, os.ErrNotExist
+	}
+	return o.manifest, nil
+}
+
+func (o *memOutput) WriteManifest(b []byte) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.manifest = b
+	return nil
+}
+
+// ReadFile returns the content of a file of the site.
+func (o *memOutput) ReadFile(file string) ([]byte, error) {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+	e, ok := o.files[file]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return e.data, nil
+}
+
+// Open opens a file or a directory of the site for http.FileServer.
+// Directories only exist as the prefix of their files.
+func (o *memOutput) Open(name string) (http.File, error) {
+	file := strings.TrimPrefix(path.Clean("/"+name), "/")
+
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+	if e, ok := o.files[file]; ok {
+		info := memInfo{path.Base(file), int64(len(e.data)), e.modTime, false}
+		return &memFile{bytes.NewReader(e.data), info}, nil
+	}
+	prefix := file + "/"
+	if file == "" {
+		prefix = ""
+	}
+	for f := range o.files {
+		if strings.HasPrefix(f, prefix) {
+			info := memInfo{path.Base("/" + file), 0, time.Time{}, true}
+			return &memFile{bytes.NewReader(nil), info}, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// memFile is an open file of a memOutput. Directories are not listed.
+type memFile struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+func (f *memFile) Readdir(count int) ([]os.FileInfo, error) {
+	if count > 0 {
+		return nil, io.EOF
+	}
+	return nil, nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return i.dir }
+func (i memInfo) Sys() interface{}   { return nil }
+
+func (i memInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
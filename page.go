@@ -0,0 +1,236 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+/*
+ Page rendering. Every page is rendered with its own Page context, so
+ the pages of a build are rendered concurrently by a pool of workers.
+*/
+
+// Page is the data of the theme templates. It embeds the blog, so the
+// templates keep using {{.Info.Name}}, {{.Statics}} and the rest of
+// the blog fields and methods.
+type Page struct {
+	*Blog
+	Post        *Article
+	Prev        *Article // older post
+	Next        *Article // newer post
+	TagSelected Tag
+	Pager       *Pager
+	Feeds       []FeedLink // feeds of the page, besides the blog ones
+}
+
+// Pager is a page of a list of posts, like the home or a tag page.
+// PrevURL links to the newer posts and NextURL to the older ones.
+type Pager struct {
+	Current int
+	Total   int
+	Posts   Articles
+	PrevURL string
+	NextURL string
+	file    string
+}
+
+// The page templates of a theme. Each one is executed with the "main"
+// template of main.html.
+var pageTemplates = []string{
+	"post",
+	"static",
+	"last-posts",
+	"archive",
+	"tag-index",
+	"all-tags",
+}
+
+type renderJob struct {
+	file string
+	key  string
+	tmpl string
+	page *Page
+}
+
+// name tells what a job renders, for the errors.
+func (j renderJob) name() string {
+	if j.page.Post != nil {
+		return j.page.Post.File
+	}
+	return "the " + j.tmpl + " page"
+}
+
+// buildErrors keeps every error of a build, in the order of the pages.
+type buildErrors []error
+
+func (e buildErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i := range e {
+		msgs[i] = e[i].Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (p *Page) GetSelectedPost() *Article {
+	return p.Post
+}
+
+func (p *Page) GetSelectedStatic() *Article {
+	return p.Post
+}
+
+func (blog *Blog) newPage() *Page {
+	return &Page{Blog: blog}
+}
+
+// paginate splits posts in pages of perPage posts. The first page is
+// the first file and the rest are in dir/page/N/index.html.
+func (blog *Blog) paginate(posts Articles, perPage int, first string, dir string) []*Pager {
+	total := (len(posts) + perPage - 1) / perPage
+	if total == 0 {
+		total = 1
+	}
+
+	url := func(n int) string {
+		if n == 1 {
+			return blog.Info["Url"] + "/" + first
+		}
+		return fmt.Sprintf("%s/%spage/%d/", blog.Info["Url"], dir, n)
+	}
+
+	pagers := make([]*Pager, total)
+	for n := 1; n <= total; n++ {
+		p := &Pager{Current: n, Total: total}
+		start, end := (n-1)*perPage, n*perPage
+		if end > len(posts) {
+			end = len(posts)
+		}
+		p.Posts = posts[start:end]
+		if n > 1 {
+			p.PrevURL = url(n - 1)
+		}
+		if n < total {
+			p.NextURL = url(n + 1)
+		}
+		p.file = first
+		if n > 1 {
+			p.file = fmt.Sprintf("%spage/%d/index.html", dir, n)
+		}
+		pagers[n-1] = p
+	}
+	return pagers
+}
+
+func (p *Pager) key() string {
+	return fmt.Sprintf("%d/%d", p.Current, p.Total)
+}
+
+// The templates shared by the page templates. They are optional, so
+// the themes without them still work.
+var partialTemplates = []string{
+	"pager",
+}
+
+// parseTemplates reads the theme templates once for the whole build.
+func (blog *Blog) parseTemplates() error {
+	partials := make([]string, 0, len(partialTemplates))
+	for _, name := range partialTemplates {
+		file := blog.ThemeDir + "/" + name + ".html"
+		if _, err := os.Stat(file); err == nil {
+			partials = append(partials, file)
+		}
+	}
+
+	blog.templates = make(map[string]*template.Template)
+	for _, name := range pageTemplates {
+		t := template.New("main")
+		files := append([]string{blog.ThemeDir + "/main.html",
+			blog.ThemeDir + "/" + name + ".html"}, partials...)
+		_, err := t.ParseFiles(files...)
+		if err != nil {
+			return err
+		}
+		blog.templates[name] = t
+	}
+	return nil
+}
+
+// renderPages renders the jobs with a pool of workers. It does not
+// stop on errors: all of them are returned together.
+func (blog *Blog) renderPages(jobs []renderJob) error {
+	// two pages in the same file, like the page of a tag called index
+	// and tags/index.html, would replace each other
+	files := make(map[string]renderJob, len(jobs))
+	for _, j := range jobs {
+		if k, ok := files[j.file]; ok {
+			return fmt.Errorf("%s is the file of %s and of %s", j.file, k.name(), j.name())
+		}
+		files[j.file] = j
+	}
+
+	errs := make([]error, len(jobs))
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				errs[i] = blog.renderPage(jobs[i])
+			}
+		}()
+	}
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	failed := make(buildErrors, 0)
+	for i := range errs {
+		if errs[i] != nil {
+			failed = append(failed, errors.New(jobs[i].file+": "+errs[i].Error()))
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+func (blog *Blog) renderPage(job renderJob) error {
+	t, ok := blog.templates[job.tmpl]
+	if !ok {
+		return errors.New("Unknown template " + job.tmpl)
+	}
+	return blog.buildFile(job.file, job.key, func(w io.Writer) error {
+		return t.ExecuteTemplate(w, "main", job.page)
+	})
+}
@@ -0,0 +1,36 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestRenderPagesInTheSameFile(t *testing.T) {
+	blog := &Blog{}
+	jobs := []renderJob{
+		{"tags/index.html", "", "tag-index", &Page{Blog: blog}},
+		{"tags/index.html", "", "all-tags", &Page{Blog: blog}},
+	}
+	if err := blog.renderPages(jobs); err == nil {
+		t.Error("two pages in the same file")
+	}
+}
@@ -0,0 +1,122 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+ Permalinks. The URLs of the posts and static pages come from the
+ PostPermalink and StaticPermalink patterns of config.json, with the
+ :year, :month, :day and :slug (the id) of the article. A pattern
+ ending in / is a directory with an index.html.
+*/
+
+const (
+	DEFAULT_POST_PERMALINK   = "/html/:year/:month-:slug.html"
+	DEFAULT_STATIC_PERMALINK = "/html/static-:slug.html"
+)
+
+// Permalink returns the path of the article in the blog, like
+// /html/2013/05-my-post.html.
+func (a *Article) Permalink() string {
+	return a.permalink
+}
+
+// URL returns the absolute URL of the article.
+func (a *Article) URL() string {
+	return a.baseURL + a.permalink
+}
+
+// file returns the file of the article in the publish directory.
+func (a *Article) file() string {
+	file := strings.TrimPrefix(a.permalink, "/")
+	if file == "" || strings.HasSuffix(file, "/") {
+		file += "index.html"
+	}
+	return file
+}
+
+func expandPermalink(pattern string, a *Article) string {
+	r := strings.NewReplacer(
+		":year", a.Date.Format("2006"),
+		":month", a.Date.Format("01"),
+		":day", a.Date.Format("02"),
+		":slug", a.Id)
+	p := r.Replace(pattern)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
+
+func (blog *Blog) permalinkPattern(key string, def string) (string, error) {
+	pattern, ok := blog.Info[key]
+	if !ok || strings.TrimSpace(pattern) == "" {
+		return def, nil
+	}
+	if !strings.Contains(pattern, ":slug") {
+		return "", errors.New(key + " of config.json must have :slug")
+	}
+	return pattern, nil
+}
+
+// setPermalink sets the permalink of the article with the pattern of
+// its kind.
+func (a *Article) setPermalink(blog *Blog, posts string, statics string) {
+	pattern := posts
+	if a.static {
+		pattern = statics
+	}
+	a.permalink = expandPermalink(pattern, a)
+	a.baseURL = blog.Info["Url"]
+}
+
+// makePermalinks sets the permalink of every post and static page. Two
+// articles with the same permalink fail the build.
+func (blog *Blog) makePermalinks() error {
+	posts, err := blog.permalinkPattern("PostPermalink", DEFAULT_POST_PERMALINK)
+	if err != nil {
+		return err
+	}
+	statics, err := blog.permalinkPattern("StaticPermalink", DEFAULT_STATIC_PERMALINK)
+	if err != nil {
+		return err
+	}
+
+	// the posts that are not published get their permalink too, for
+	// grom rename, but they can not collide
+	for _, a := range blog.unpublished {
+		a.setPermalink(blog, posts, statics)
+	}
+	used := make(map[string]*Article)
+	for _, a := range append(append(Articles{}, blog.Posts...), blog.Statics...) {
+		a.setPermalink(blog, posts, statics)
+		if b, ok := used[a.file()]; ok {
+			return fmt.Errorf("%s and %s have the same permalink %s", b.File, a.File, a.permalink)
+		}
+		used[a.file()] = a
+	}
+	return nil
+}
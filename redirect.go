@@ -0,0 +1,194 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+/*
+ Aliases. The aliases property of an article lists its old paths, like
+ the URL of a renamed post. Every alias gets a page redirecting to the
+ article and, with the Redirects key of config.json, the redirect
+ rules of the web server: "netlify" writes a _redirects file and
+ "nginx" a redirects.map for the map directive.
+*/
+
+// redirect is an alias of an article.
+type redirect struct {
+	From string
+	To   *Article
+}
+
+var redirectTemplate = `{{define "redirect"}}<!DOCTYPE html>
+<html>
+<head>
+<title>{{.To.Title}}</title>
+<meta http-equiv='Content-Type' content='text/html; charset=utf-8'>
+<link rel="canonical" href="{{.To.URL}}">
+<meta name="robots" content="noindex">
+<meta http-equiv="refresh" content="0; url={{.To.URL}}">
+</head>
+<body>
+<a href="{{.To.URL}}">{{.To.URL}}</a>
+</body>
+</html>
+{{end}}
+`
+
+// aliasPath returns an alias as a clean path of the blog, like
+// /old/post/. Aliases out of the blog, like ../x, are rejected.
+func aliasPath(alias string) (string, error) {
+	alias = strings.TrimSpace(alias)
+	rel := path.Clean(strings.TrimLeft(alias, "/"))
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", errors.New("bad alias " + alias)
+	}
+	if strings.HasSuffix(alias, "/") {
+		rel += "/"
+	}
+	return "/" + rel, nil
+}
+
+// aliasFile returns the file of an alias in the publish directory.
+func aliasFile(alias string) string {
+	file := strings.TrimPrefix(alias, "/")
+	if file == "" || strings.HasSuffix(file, "/") {
+		file += "index.html"
+	}
+	return file
+}
+
+// makeRedirects reads the aliases of every post and static page. An
+// alias can not be the permalink of another article nor an alias of
+// two of them.
+func (blog *Blog) makeRedirects() error {
+	all := append(append(Articles{}, blog.Posts...), blog.Statics...)
+	files := make(map[string]*Article, len(all))
+	for _, a := range all {
+		files[a.file()] = a
+	}
+
+	blog.redirects = make([]redirect, 0)
+	for _, a := range all {
+		for _, alias := range a.Meta.List("Aliases") {
+			from, err := aliasPath(alias)
+			if err != nil {
+				return fmt.Errorf("%s: %v", a.File, err)
+			}
+			if b, ok := files[aliasFile(from)]; ok {
+				if b == a {
+					continue
+				}
+				return fmt.Errorf("%s: alias %s is already used by %s", a.File, from, b.File)
+			}
+			files[aliasFile(from)] = a
+			blog.redirects = append(blog.redirects, redirect{from, a})
+		}
+	}
+	sort.Slice(blog.redirects, func(i, j int) bool {
+		return blog.redirects[i].From < blog.redirects[j].From
+	})
+	return nil
+}
+
+// makeRedirectPages builds the pages redirecting the aliases. It must
+// be called once every other file of the site is built, since an alias
+// can not replace one of them.
+func (blog *Blog) makeRedirectPages() error {
+	t := template.Must(template.New("redirect").Parse(redirectTemplate))
+	for _, r := range blog.redirects {
+		r := r
+		if blog.manifest.has(aliasFile(r.From)) {
+			return fmt.Errorf("%s: alias %s is a page of the blog", r.To.File, r.From)
+		}
+		key := hashOf("redirect", r.From, r.To.Permalink(), r.To.Title)
+		err := blog.buildFile(aliasFile(r.From), key, func(w io.Writer) error {
+			return t.ExecuteTemplate(w, "redirect", r)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeRedirectRules writes the redirects for the web servers of the
+// Redirects key of config.json.
+func (blog *Blog) makeRedirectRules() error {
+	servers := blog.Info["Redirects"]
+	if servers == "" {
+		return nil
+	}
+
+	key := make([]string, 0, len(blog.redirects)*2)
+	for _, r := range blog.redirects {
+		key = append(key, r.From, r.To.Permalink())
+	}
+
+	for _, server := range strings.Split(servers, ",") {
+		var file, line string
+		switch strings.TrimSpace(server) {
+		case "netlify":
+			file, line = "_redirects", "%s %s 301\n"
+		case "nginx":
+			file, line = "redirects.map", "%s %s;\n"
+		default:
+			return fmt.Errorf("Unknown server %s in Redirects of config.json", server)
+		}
+		err := blog.buildFile(file, hashOf(append([]string{file}, key...)...), func(w io.Writer) error {
+			for _, r := range blog.redirects {
+				if _, err := fmt.Fprintf(w, line, r.From, r.To.Permalink()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redirectHandler serves the aliases with a 301 to the article, as the
+// web server would do with the redirect rules.
+func (blog *Blog) redirectHandler(next http.Handler) http.Handler {
+	targets := make(map[string]string, len(blog.redirects))
+	for _, r := range blog.redirects {
+		targets[path.Clean(r.From)] = r.To.Permalink()
+		targets["/"+aliasFile(r.From)] = r.To.Permalink()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if to, ok := targets[path.Clean(req.URL.Path)]; ok {
+			http.Redirect(w, req, to, http.StatusMovedPermanently)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
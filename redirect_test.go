@@ -0,0 +1,45 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestAliasPath(t *testing.T) {
+	tests := []struct{ alias, path, file string }{
+		{"/old/post/", "/old/post/", "old/post/index.html"},
+		{"old//post/./", "/old/post/", "old/post/index.html"},
+		{" html/2017/07-old.html ", "/html/2017/07-old.html", "html/2017/07-old.html"},
+		{"/a/../b.html", "/b.html", "b.html"},
+	}
+	for _, test := range tests {
+		p, err := aliasPath(test.alias)
+		if err != nil || p != test.path || aliasFile(p) != test.file {
+			t.Errorf("aliasPath(%q) = %q %v, file %q", test.alias, p, err, aliasFile(p))
+		}
+	}
+	for _, alias := range []string{"", "/", "..", "../../x", "/../x", "a/../../x"} {
+		if p, err := aliasPath(alias); err == nil {
+			t.Errorf("aliasPath(%q) = %q, want an error", alias, p)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/*
+ Renaming of posts. grom rename changes the id of a post or static
+ page: it updates its properties and its file name, records its old
+ URL in its aliases and rewrites the links of the blog to it.
+*/
+
+// validID matches the ids that NewArticle could make.
+var validID = regexp.MustCompile(`^[\w.-]+$`)
+
+// Rename changes the id of an article from old to new. Every source is
+// changed in memory first, so nothing is written when one of them can
+// not be changed.
+func (blog *Blog) Rename(old string, new string) error {
+	if !validID.MatchString(new) {
+		return errors.New("Bad id " + new)
+	}
+
+	// expired posts are not loaded with the drafts and the future posts
+	all := append(append(Articles{}, blog.Posts...), blog.Statics...)
+	all = append(all, blog.unpublished...)
+	var a *Article
+	for _, b := range all {
+		switch b.Id {
+		case old:
+			a = b
+		case new:
+			return errors.New("There is another post with id " + new)
+		}
+	}
+	if a == nil {
+		return errors.New("There is no post with id " + old)
+	}
+
+	err := blog.makePermalinks()
+	if err != nil {
+		return err
+	}
+	oldPermalink := a.Permalink()
+	oldURL := a.URL()
+	a.Id = new
+	if err = blog.makePermalinks(); err != nil {
+		return err
+	}
+
+	file := renamedFile(a.File, old, new)
+	if file != a.File {
+		if _, err := os.Stat(file); err == nil {
+			return errors.New("File " + file + " already exists")
+		}
+	}
+
+	links := newLinkRewriter(old, new, oldURL, a.URL(), oldPermalink, a.Permalink())
+	raw, err := ioutil.ReadFile(a.File)
+	if err != nil {
+		return err
+	}
+	raw, err = renameProperties(links.rewrite(raw), old, new, oldPermalink)
+	if err != nil {
+		return errors.New(a.File + ": " + err.Error())
+	}
+
+	// links of the other articles
+	changed := make(map[string][]byte)
+	for _, b := range all {
+		if b == a {
+			continue
+		}
+		src, err := ioutil.ReadFile(b.File)
+		if err != nil {
+			return err
+		}
+		if c := links.rewrite(src); !bytes.Equal(c, src) {
+			changed[b.File] = c
+		}
+	}
+
+	for f, c := range changed {
+		if err = ioutil.WriteFile(f, c, 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Links updated in %s\n", f)
+	}
+	if err = ioutil.WriteFile(file, raw, 0644); err != nil {
+		return err
+	}
+	if file != a.File {
+		if err = os.Remove(a.File); err != nil {
+			return err
+		}
+		fmt.Printf("%s moved to %s\n", a.File, file)
+	} else {
+		fmt.Printf("%s updated\n", a.File)
+	}
+	return nil
+}
+
+// renamedFile returns the file of an article after renaming it: the id
+// is replaced in its name, keeping the prefix of AddArticle, like the
+// month of 10-<id>.md. Other names are kept.
+func renamedFile(file string, old string, new string) string {
+	ext := filepath.Ext(file)
+	name := strings.TrimSuffix(filepath.Base(file), ext)
+	i := strings.LastIndex(name, old)
+	if i < 0 || i+len(old) != len(name) {
+		return file
+	}
+	return filepath.Join(filepath.Dir(file), name[:i]+new+ext)
+}
+
+type linkRewriter struct {
+	wiki    *regexp.Regexp
+	new     string
+	url     *strings.Replacer
+	path    *regexp.Regexp
+	newPath string
+}
+
+// newLinkRewriter returns the rewriter of the links to an article. The
+// URL of the blog is changed anywhere, but its path only when it is
+// the whole target of a link, since other sites can have it too.
+func newLinkRewriter(old, new, oldURL, newURL, oldPath, newPath string) *linkRewriter {
+	return &linkRewriter{
+		wiki:    regexp.MustCompile(`\[\[` + regexp.QuoteMeta(old) + `(\|[^\]\n]+)?\]\]`),
+		new:     new,
+		url:     strings.NewReplacer(oldURL, newURL),
+		path:    regexp.MustCompile(`(\]\(|\[\[|href="|href=')` + regexp.QuoteMeta(oldPath) + `([)\]"'#?\s])`),
+		newPath: strings.Replace(newPath, "$", "$$", -1),
+	}
+}
+
+// rewrite changes the wiki links and the URLs of the old article.
+func (l *linkRewriter) rewrite(raw []byte) []byte {
+	raw = l.wiki.ReplaceAll(raw, []byte("[["+l.new+"$1]]"))
+	raw = []byte(l.url.Replace(string(raw)))
+	return l.path.ReplaceAll(raw, []byte("${1}"+l.newPath+"${2}"))
+}
+
+var (
+	yamlAliasesReg = regexp.MustCompile(`(?mi)^aliases[ \t]*:[ \t]*(.*?)[ \t]*$`)
+	tomlAliasesReg = regexp.MustCompile(`(?mi)^aliases[ \t]*=[ \t]*\[(.*)\][ \t]*$`)
+	propAliasesReg = regexp.MustCompile(`(?mi)^([ \t]*):Aliases:[ \t]*(.*?)[ \t]*$`)
+)
+
+// renameProperties changes the id of the properties of a source file
+// and adds the alias to them.
+func renameProperties(raw []byte, old string, new string, alias string) ([]byte, error) {
+	fm, delim, body := splitFrontMatter(raw)
+	switch {
+	case bytes.Equal(delim, yamlDelim):
+		fm, err := renameYAML(string(fm), old, new, alias)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte("---\n"+fm+"---\n"), body...), nil
+	case bytes.Equal(delim, tomlDelim):
+		fm, err := renameTOML(string(fm), old, new, alias)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte("+++\n"+fm+"+++\n"), body...), nil
+	}
+	return renameDrawer(string(raw), old, new, alias)
+}
+
+func renameYAML(fm string, old string, new string, alias string) (string, error) {
+	idReg := regexp.MustCompile(`(?mi)^(id[ \t]*:[ \t]*)(["']?)` + regexp.QuoteMeta(old) + `(["']?)([ \t]+#.*)?[ \t]*$`)
+	if !idReg.MatchString(fm) {
+		return "", errors.New("No id property")
+	}
+	fm = idReg.ReplaceAllString(fm, "${1}${2}"+strings.Replace(new, "$", "$$", -1)+"${3}${4}")
+
+	quoted := fmt.Sprintf("%q", alias)
+	loc := yamlAliasesReg.FindStringSubmatchIndex(fm)
+	if loc == nil {
+		return fm + "aliases: [" + quoted + "]\n", nil
+	}
+	value := fm[loc[2]:loc[3]]
+	switch {
+	case value == "":
+		// a block list: the alias is the first item
+		return fm[:loc[1]] + "\n  - " + quoted + fm[loc[1]:], nil
+	case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+		items := strings.TrimSpace(value[1 : len(value)-1])
+		if items != "" {
+			items += ", "
+		}
+		return fm[:loc[2]] + "[" + items + quoted + "]" + fm[loc[3]:], nil
+	default:
+		return fm[:loc[2]] + "[" + value + ", " + quoted + "]" + fm[loc[3]:], nil
+	}
+}
+
+func renameTOML(fm string, old string, new string, alias string) (string, error) {
+	idReg := regexp.MustCompile(`(?mi)^(id[ \t]*=[ \t]*)(["'])` + regexp.QuoteMeta(old) + `(["'])`)
+	if !idReg.MatchString(fm) {
+		return "", errors.New("No id property")
+	}
+	fm = idReg.ReplaceAllString(fm, "${1}${2}"+strings.Replace(new, "$", "$$", -1)+"${3}")
+
+	quoted := fmt.Sprintf("%q", alias)
+	loc := tomlAliasesReg.FindStringSubmatchIndex(fm)
+	if loc == nil {
+		return fm + "aliases = [" + quoted + "]\n", nil
+	}
+	items := strings.TrimSpace(fm[loc[2]:loc[3]])
+	if items != "" {
+		items += ", "
+	}
+	return fm[:loc[2]] + items + quoted + fm[loc[3]:], nil
+}
+
+// renameDrawer changes the :Id: property of an Org-mode drawer or of
+// a legacy comment block.
+func renameDrawer(raw string, old string, new string, alias string) ([]byte, error) {
+	idReg := regexp.MustCompile(`(?mi)^([ \t]*):Id:([ \t]*)` + regexp.QuoteMeta(old) + `[ \t]*$`)
+	loc := idReg.FindStringSubmatchIndex(raw)
+	if loc == nil {
+		return nil, errors.New("No :Id: property")
+	}
+	indent := raw[loc[2]:loc[3]]
+	id := indent + ":Id:" + raw[loc[4]:loc[5]] + new
+	raw = raw[:loc[0]] + id + raw[loc[1]:]
+
+	if a := propAliasesReg.FindStringSubmatchIndex(raw); a != nil {
+		value := raw[a[4]:a[5]]
+		if value != "" {
+			value += ", "
+		}
+		return []byte(raw[:a[4]] + value + alias + raw[a[5]:]), nil
+	}
+	// the alias goes after the id
+	end := loc[0] + len(id)
+	return []byte(raw[:end] + "\n" + indent + ":Aliases: " + alias + raw[end:]), nil
+}
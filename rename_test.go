@@ -0,0 +1,123 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestValidID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"post-bee":        true,
+		"your_first.post": true,
+		"":                false,
+		"a b":             false,
+		"a/b":             false,
+	} {
+		if validID.MatchString(id) != want {
+			t.Errorf("validID(%q) = %v", id, !want)
+		}
+	}
+}
+
+func TestRenamedFile(t *testing.T) {
+	tests := []struct{ file, want string }{
+		{"post/2026/10-foo.md", "post/2026/10-bar.md"},
+		{"post/2026/foo.org", "post/2026/bar.org"},
+		{"post/2026/foo-old.md", "post/2026/foo-old.md"},
+	}
+	for _, test := range tests {
+		if got := renamedFile(test.file, "foo", "bar"); got != test.want {
+			t.Errorf("renamedFile(%q) = %q, want %q", test.file, got, test.want)
+		}
+	}
+}
+
+func TestRenameProperties(t *testing.T) {
+	tests := []struct{ name, src, want string }{
+		{"yaml",
+			"---\ntitle: A\nid: foo\n---\nbody\n",
+			"---\ntitle: A\nid: bar\naliases: [\"/old/\"]\n---\nbody\n"},
+		{"yaml comment",
+			"---\nid: \"foo\" # note\n---\n",
+			"---\nid: \"bar\" # note\naliases: [\"/old/\"]\n---\n"},
+		{"yaml inline aliases",
+			"---\nid: foo\naliases: [/a/]\n---\n",
+			"---\nid: bar\naliases: [/a/, \"/old/\"]\n---\n"},
+		{"yaml block aliases",
+			"---\nid: foo\naliases:\n  - /a/\n---\n",
+			"---\nid: bar\naliases:\n  - \"/old/\"\n  - /a/\n---\n"},
+		{"yaml scalar alias",
+			"---\nid: foo\naliases: /a/\n---\n",
+			"---\nid: bar\naliases: [/a/, \"/old/\"]\n---\n"},
+		{"toml",
+			"+++\nid = \"foo\"\naliases = [\"/a/\"]\n+++\n",
+			"+++\nid = \"bar\"\naliases = [\"/a/\", \"/old/\"]\n+++\n"},
+		{"org",
+			"#+TITLE: A\n:PROPERTIES:\n:Id: foo\n:END:\n",
+			"#+TITLE: A\n:PROPERTIES:\n:Id: bar\n:Aliases: /old/\n:END:\n"},
+		{"legacy",
+			"# A\n<!---\n:Id: foo\n:Aliases: /a/\n-->\n",
+			"# A\n<!---\n:Id: bar\n:Aliases: /a/, /old/\n-->\n"},
+	}
+	for _, test := range tests {
+		got, err := renameProperties([]byte(test.src), "foo", "bar", "/old/")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRenamePropertiesWithoutId(t *testing.T) {
+	for _, src := range []string{
+		"---\ntitle: A\n---\n",
+		"+++\ntitle = \"A\"\n+++\n",
+		"# A\n<!---\n:Date: <2019-07-01 Mon>\n-->\n",
+	} {
+		if _, err := renameProperties([]byte(src), "foo", "bar", "/old/"); err == nil {
+			t.Errorf("no error renaming %q", src)
+		}
+	}
+}
+
+func TestLinkRewriter(t *testing.T) {
+	l := newLinkRewriter("go", "golang", "http://example.com/go/", "http://example.com/golang/", "/go/", "/golang/")
+	tests := []struct{ src, want string }{
+		{"see [[go]] and [[go|Go]]", "see [[golang]] and [[golang|Go]]"},
+		{"[Go](/go/) [Go](/go/#intro) [Go](/go/ \"title\")",
+			"[Go](/golang/) [Go](/golang/#intro) [Go](/golang/ \"title\")"},
+		{"[[/go/][Go]] <a href=\"/go/\">Go</a> <a href='/go/'>",
+			"[[/golang/][Go]] <a href=\"/golang/\">Go</a> <a href='/golang/'>"},
+		{"[Go](http://example.com/go/)", "[Go](http://example.com/golang/)"},
+		{"[the docs](https://golang.org/go/)", "[the docs](https://golang.org/go/)"},
+		{"[more](/go/more/) and /go/ in the text", "[more](/go/more/) and /go/ in the text"},
+		{"[[gopher]]", "[[gopher]]"},
+	}
+	for _, test := range tests {
+		if got := string(l.rewrite([]byte(test.src))); got != test.want {
+			t.Errorf("rewrite(%q) = %q, want %q", test.src, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/russross/blackfriday"
+)
+
+/*
+ Renderers of the source files. The renderer of a post is chosen by the
+ extension of its file: Org-mode for .org files and Markdown for the
+ rest. The Markdown extensions are set with the MarkdownExtensions key
+ of config.json.
+*/
+
+// Renderer turns the content of a source file into HTML. The url is
+// the blog URL, used to link the images of the blog. With skipTitle,
+// the first level 1 heading is left out, since it is the title of the
+// post.
+type Renderer interface {
+	HTML(content []byte, url string, skipTitle bool) string
+}
+
+type OrgRenderer struct {
+	Highlight highlightOptions
+}
+
+func (o OrgRenderer) HTML(content []byte, url string, skipTitle bool) string {
+	return Org2HTML(moreReg.ReplaceAll(content, nil), url, skipTitle, o.Highlight)
+}
+
+type MarkdownRenderer struct {
+	Extensions int
+	HTMLFlags  int
+	Highlight  highlightOptions
+}
+
+func (md MarkdownRenderer) HTML(content []byte, url string, skipTitle bool) string {
+	renderer := &markdownHTML{
+		Renderer: blackfriday.HtmlRenderer(md.HTMLFlags, "", ""),
+		url:      url,
+		title:    !skipTitle,
+		opts:     md.Highlight,
+	}
+	return string(blackfriday.Markdown(content, renderer, md.Extensions))
+}
+
+// The Markdown extensions of config.json. smart-punctuation is not a
+// blackfriday extension but a flag of its HTML renderer.
+var markdownExtensions = map[string]int{
+	"no-intra-emphasis":    blackfriday.EXTENSION_NO_INTRA_EMPHASIS,
+	"tables":               blackfriday.EXTENSION_TABLES,
+	"fenced-code":          blackfriday.EXTENSION_FENCED_CODE,
+	"autolinks":            blackfriday.EXTENSION_AUTOLINK,
+	"strikethrough":        blackfriday.EXTENSION_STRIKETHROUGH,
+	"space-headings":       blackfriday.EXTENSION_SPACE_HEADERS,
+	"hard-line-breaks":     blackfriday.EXTENSION_HARD_LINE_BREAK,
+	"footnotes":            blackfriday.EXTENSION_FOOTNOTES,
+	"heading-ids":          blackfriday.EXTENSION_HEADER_IDS,
+	"auto-heading-ids":     blackfriday.EXTENSION_AUTO_HEADER_IDS,
+	"backslash-line-break": blackfriday.EXTENSION_BACKSLASH_LINE_BREAK,
+	"definition-lists":     blackfriday.EXTENSION_DEFINITION_LISTS,
+	"smart-punctuation":    0,
+}
+
+const smartPunctuationFlags = blackfriday.HTML_USE_SMARTYPANTS |
+	blackfriday.HTML_SMARTYPANTS_FRACTIONS |
+	blackfriday.HTML_SMARTYPANTS_DASHES |
+	blackfriday.HTML_SMARTYPANTS_LATEX_DASHES
+
+// The extensions of blackfriday.MarkdownCommon, used when config.json
+// has no MarkdownExtensions.
+const DEFAULT_MARKDOWN_EXTENSIONS = "no-intra-emphasis, tables, fenced-code, " +
+	"autolinks, strikethrough, space-headings, heading-ids, " +
+	"backslash-line-break, definition-lists, smart-punctuation"
+
+func loadMarkdownRenderer(info BlogInfo) (MarkdownRenderer, error) {
+	md := MarkdownRenderer{HTMLFlags: blackfriday.HTML_USE_XHTML}
+	list, ok := info["MarkdownExtensions"]
+	if !ok {
+		list = DEFAULT_MARKDOWN_EXTENSIONS
+	}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		ext, ok := markdownExtensions[name]
+		if !ok {
+			return md, errors.New("Unknown Markdown extension " + name + " in config.json")
+		}
+		if name == "smart-punctuation" {
+			md.HTMLFlags |= smartPunctuationFlags
+		}
+		md.Extensions |= ext
+	}
+	return md, nil
+}
+
+// markdownHTML is the blackfriday HTML renderer of grom. It skips the
+// first level 1 heading when it is the title of the post, highlights
+// the code blocks and links the blog images to their thumbs.
+type markdownHTML struct {
+	blackfriday.Renderer
+	url   string
+	title bool             // the title has been skipped or must not be
+	opts  highlightOptions // highlighting of the blog
+}
+
+func (r *markdownHTML) Header(out *bytes.Buffer, text func() bool, level int, id string) {
+	if level == 1 && !r.title {
+		r.title = true
+		mark := out.Len()
+		text()
+		out.Truncate(mark)
+		return
+	}
+	r.Renderer.Header(out, text, level, id)
+}
+
+func (r *markdownHTML) BlockCode(out *bytes.Buffer, text []byte, info string) {
+	lang, opts := parseCodeInfo(info, r.opts)
+	var code bytes.Buffer
+	if !highlightCode(&code, string(text), lang, opts) {
+		r.Renderer.BlockCode(out, text, lang)
+		return
+	}
+	if out.Len() > 0 {
+		out.WriteByte('\n')
+	}
+	out.Write(code.Bytes())
+}
+
+// Image links the thumb of the blog images, like ![img](../img/file),
+// to the real size image.
+func (r *markdownHTML) Image(out *bytes.Buffer, link []byte, title []byte, alt []byte) {
+	if !bytes.HasPrefix(link, []byte("../img/")) {
+		r.Renderer.Image(out, link, title, alt)
+		return
+	}
+	img := string(bytes.TrimPrefix(link, []byte("../img/")))
+	out.WriteString("<a href='" + r.url + "/img/" + img + "'><img src='" +
+		r.url + "/img/thumbs/" + img + "' alt='" + xmlEscape(string(alt)) + "'/></a>")
+}
@@ -0,0 +1,77 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSkipTitle(t *testing.T) {
+	site, err := loadSettings(BlogInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		r   Renderer
+		src string
+	}{
+		{site.markdown, "# Title\n\ntext\n"},
+		{OrgRenderer{}, "* Title\ntext\n"},
+	}
+	for _, test := range tests {
+		if got := test.r.HTML([]byte(test.src), "", true); strings.Contains(got, "Title") {
+			t.Errorf("%T: title not skipped: %s", test.r, got)
+		}
+		if got := test.r.HTML([]byte(test.src), "", false); !strings.Contains(got, "Title</h1>") {
+			t.Errorf("%T: heading skipped: %s", test.r, got)
+		}
+	}
+}
+
+func TestTitleHeading(t *testing.T) {
+	tests := []struct {
+		file, src string
+		head      bool
+	}{
+		{"a.md", "---\ntitle: A\ndate: 2020-01-01\n---\n# Introduction\n", false},
+		{"a.md", "# A\n<!---\n:Date: <2020-01-01 Wed>\n-->\ntext\n", true},
+		{"a.org", "#+TITLE: A\n:PROPERTIES:\n:Date: <2020-01-01 Wed>\n:END:\n* Introduction\n", false},
+		{"a.org", "* A\n:PROPERTIES:\n:Date: <2020-01-01 Wed>\n:END:\ntext\n", true},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		file := dir + "/" + test.file
+		if err := ioutil.WriteFile(file, []byte(test.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		a, err := ParseArticle(file, time.Local)
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		if a.Title != "A" || a.titleHead != test.head {
+			t.Errorf("%q: title %q from heading %v", test.src, a.Title, a.titleHead)
+		}
+	}
+}
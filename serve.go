@@ -0,0 +1,382 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+/*
+ Live preview. grom serve builds the blog, watches its sources and
+ builds it again when they change. The browsers get a script that
+ reloads the page after every build and shows the build errors.
+*/
+
+type preview struct {
+	dir   string
+	opts  BuildOptions
+	hub   *Hub
+	files *memOutput // the site, kept out of the PublishDir
+
+	mutex sync.RWMutex // the blog is replaced by every build
+	blog  *Blog
+}
+
+var liveReloadScript = `<script>
+(function() {
+  var overlay = null, progress = null;
+  function box(css) {
+    var e = document.createElement("pre");
+    e.style.cssText = "position:fixed;margin:0;padding:10px 15px;z-index:10000;" +
+      "white-space:pre-wrap;font-size:13px;" + css;
+    document.body.appendChild(e);
+    return e;
+  }
+  function showError(msg) {
+    if (!overlay) {
+      overlay = box("top:0;left:0;right:0;max-height:50%;overflow:auto;" +
+        "background:#fdd;color:#900;border-bottom:2px solid #900");
+    }
+    overlay.textContent = msg;
+  }
+  function showProgress(msg) {
+    if (!progress) {
+      progress = box("bottom:10px;right:10px;background:#333;color:#fff;opacity:0.8");
+    }
+    progress.textContent = msg;
+  }
+  function hideError() {
+    if (overlay) {
+      overlay.parentNode.removeChild(overlay);
+      overlay = null;
+    }
+  }
+  function hideProgress() {
+    if (progress) {
+      progress.parentNode.removeChild(progress);
+      progress = null;
+    }
+  }
+  // the new stylesheet replaces the old one once it is loaded, so
+  // the page does not flash
+  function swapLink(old, href) {
+    var link = old.cloneNode();
+    link.href = href;
+    link.onload = function() {
+      old.parentNode.removeChild(old);
+    };
+    old.parentNode.insertBefore(link, old.nextSibling);
+  }
+  function swapStyle(path) {
+    var links = document.querySelectorAll("link[rel=stylesheet]");
+    for (var i = 0; i < links.length; i++) {
+      var url = new URL(links[i].href, location.href);
+      if (url.pathname.slice(-path.length) == path) {
+        url.searchParams.set("grom", Date.now());
+        swapLink(links[i], url.href);
+      }
+    }
+  }
+  function connect() {
+    var ws = new WebSocket("ws://" + location.host + "/ws");
+    ws.onmessage = function(e) {
+      var msg = JSON.parse(e.data);
+      switch (msg.type) {
+      case "reload":
+        location.reload();
+        break;
+      case "css":
+        hideProgress();
+        hideError();
+        swapStyle(msg.path);
+        break;
+      case "error":
+        hideProgress();
+        showError(msg.text);
+        break;
+      case "build-progress":
+        showProgress(msg.text);
+        break;
+      }
+    };
+    ws.onclose = function() {
+      setTimeout(connect, 1000);
+    };
+  }
+  connect();
+})();
+</script>
+`
+
+func newPreview(dir string, opts BuildOptions) *preview {
+	return &preview{dir: dir, opts: opts, hub: NewHub(), files: newMemOutput()}
+}
+
+// build loads the blog again and builds it. The manifest keeps it
+// incremental. Its errors, like the sources that can not be parsed,
+// are shown by the browsers.
+func (p *preview) build() error {
+	blog := LoadBlog(p.dir, p.opts)
+	if blog == nil {
+		err := errors.New("Error during blog load")
+		p.hub.Send(Message{Type: MsgError, Text: err.Error()})
+		return err
+	}
+	blog.output = p.files
+	err := blog.Build()
+	if err != nil {
+		p.hub.Send(Message{Type: MsgError, Text: err.Error()})
+	}
+
+	p.mutex.Lock()
+	p.blog = blog
+	p.mutex.Unlock()
+	return err
+}
+
+// rebuild builds the blog after a change of files and tells the
+// browsers to reload the page or to show the build errors. When only
+// the stylesheets of the theme change, the browsers just swap them.
+func (p *preview) rebuild(files []string) {
+	p.hub.Send(Message{Type: MsgProgress, Text: "Building the blog"})
+	err := p.build()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Build blog succesfully\n")
+
+	if styles, ok := p.themeStyles(files); ok {
+		for _, s := range styles {
+			p.hub.Send(Message{Type: MsgCSS, Path: s})
+		}
+		return
+	}
+	p.hub.Send(Message{Type: MsgReload})
+}
+
+// themeStyles returns the paths in the site of the changed files when
+// all of them are stylesheets of the theme.
+func (p *preview) themeStyles(files []string) ([]string, bool) {
+	p.mutex.RLock()
+	themeDir, theme := p.blog.ThemeDir, p.blog.Info["Theme"]
+	p.mutex.RUnlock()
+
+	styles := make([]string, 0, len(files))
+	for _, f := range files {
+		if filepath.Dir(f) != filepath.Clean(themeDir) || filepath.Ext(f) != ".css" {
+			return nil, false
+		}
+		styles = append(styles, "/themes/"+theme+"/"+filepath.Base(f))
+	}
+	return styles, len(styles) > 0
+}
+
+// watch builds the blog again when its posts, static pages, images,
+// theme or config change.
+func (p *preview) watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	p.mutex.RLock()
+	themeDir := p.blog.ThemeDir
+	p.mutex.RUnlock()
+
+	for _, d := range []string{"post", "drafts", "static", "img"} {
+		addWatchTree(watcher, p.dir+d)
+	}
+	addWatchTree(watcher, themeDir)
+	// config.json is replaced by many editors, so its directory is
+	// watched instead
+	if err = watcher.Add(p.dir); err != nil {
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		// the events of a save come together: the blog is built once
+		// they stop
+		var pending <-chan time.Time
+		changed := make(map[string]bool)
+		for {
+			select {
+			case event := <-watcher.Events:
+				if !p.watched(event.Name) {
+					continue
+				}
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+						addWatchTree(watcher, event.Name)
+					}
+				}
+				changed[event.Name] = true
+				pending = time.After(200 * time.Millisecond)
+			case <-pending:
+				files := make([]string, 0, len(changed))
+				for f := range changed {
+					files = append(files, f)
+				}
+				pending = nil
+				changed = make(map[string]bool)
+				fmt.Printf("\nChanges found, building again ...\n")
+				p.rebuild(files)
+			case err := <-watcher.Errors:
+				fmt.Println(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// watched tells if a change of a file needs a new build. Only
+// config.json is watched in the blog directory and the temporary files
+// of the editors are skipped.
+func (p *preview) watched(file string) bool {
+	name := filepath.Base(file)
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "#") ||
+		strings.HasSuffix(name, "~") {
+		return false
+	}
+	if filepath.Dir(file)+"/" == p.dir {
+		return name == "config.json"
+	}
+	return true
+}
+
+func addWatchTree(watcher *fsnotify.Watcher, dir string) {
+	filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err == nil && fi.IsDir() {
+			watcher.Add(file)
+		}
+		return nil
+	})
+}
+
+func (p *preview) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/ws" {
+		p.hub.ServeHTTP(w, r)
+		return
+	}
+
+	p.mutex.RLock()
+	blog := p.blog
+	p.mutex.RUnlock()
+
+	files := http.FileServer(p.files)
+	blog.redirectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file := r.URL.Path
+		if strings.HasSuffix(file, "/") {
+			file += "index.html"
+		}
+		if !strings.HasSuffix(file, ".html") {
+			files.ServeHTTP(w, r)
+			return
+		}
+		b, err := p.files.ReadFile(strings.TrimPrefix(path.Clean(file), "/"))
+		if err != nil {
+			// with the script, the browser shows the build errors
+			// and gets the page once it is built
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(injectScript([]byte("404 page not found\n")))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(injectScript(b))
+	})).ServeHTTP(w, r)
+}
+
+// injectScript adds the live reload script to the end of a page.
+func injectScript(page []byte) []byte {
+	html := string(page)
+	if i := strings.LastIndex(strings.ToLower(html), "</body>"); i >= 0 {
+		return []byte(html[:i] + liveReloadScript + html[i:])
+	}
+	return []byte(html + liveReloadScript)
+}
+
+// serve serves the blog until the server fails.
+func (p *preview) serve(l net.Listener) error {
+	err := p.watch()
+	if err != nil {
+		return err
+	}
+	return http.Serve(l, p)
+}
+
+// listen listens on the port, or on a free port when it is busy or 0.
+func listen(bind string, port int) (net.Listener, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(bind, strconv.Itoa(port)))
+	if err != nil && port != 0 {
+		fmt.Printf("Port %d is busy, using a free one\n", port)
+		return net.Listen("tcp", net.JoinHostPort(bind, "0"))
+	}
+	return l, err
+}
+
+// previewURL returns the URL of the preview served by l. When it
+// listens on every address, the URL uses the address of this host in
+// the network, so the preview works on other devices too.
+func previewURL(bind string, l net.Listener) string {
+	host := bind
+	if ip := net.ParseIP(bind); bind == "" || (ip != nil && ip.IsUnspecified()) {
+		host = hostAddress()
+		if host == "" {
+			host = "localhost"
+			fmt.Printf("No network address found, use --base-url to open the preview from other devices\n")
+		}
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// hostAddress returns the first IPv4 address of this host that is not
+// a loopback one, or an empty string if there is none.
+func hostAddress() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip := ipnet.IP.To4(); ip != nil && ip.IsGlobalUnicast() {
+			return ip.String()
+		}
+	}
+	return ""
+}
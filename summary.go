@@ -0,0 +1,98 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"errors"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+ Post summaries. The summary of a post is, in this order, the summary
+ key of its properties, the content before a <!--more--> line or its
+ first SummaryWords words.
+*/
+
+const DEFAULT_SUMMARY_WORDS = 50
+
+var (
+	moreReg = regexp.MustCompile(`(?im)^[ \t]*<!--\s*more\s*-->[ \t]*$`)
+	tagReg  = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// makeSummary sets the Summary of the article, in HTML, and tells in
+// HasMore if the post has more content than its summary.
+func (a *Article) makeSummary(site *siteSettings, url string, words int) {
+	if s := a.Meta.String("Summary"); s != "" {
+		a.Summary = site.markdown.HTML([]byte(s), url, false)
+		a.HasMore = true
+		return
+	}
+
+	if loc := moreReg.FindIndex(a.Content); loc != nil {
+		before := &Article{File: a.File, titleHead: a.titleHead,
+			Content: tocMarkerReg.ReplaceAll(a.Content[:loc[0]], nil)}
+		a.Summary = before.contentHTML(site, url)
+		a.HasMore = len(strings.TrimSpace(string(a.Content[loc[1]:]))) > 0
+		return
+	}
+
+	full := tocDivReg.ReplaceAllString(a.contentHTML(site, url), "")
+	text := strings.Fields(htmlText(full))
+	if len(text) <= words {
+		a.Summary = full
+		a.HasMore = false
+		return
+	}
+	a.Summary = "<p>" + html.EscapeString(strings.Join(text[:words], " ")) + " …</p>\n"
+	a.HasMore = true
+}
+
+// htmlText returns the text of an HTML fragment without its tags.
+func htmlText(s string) string {
+	return strings.TrimSpace(html.UnescapeString(tagReg.ReplaceAllString(s, "")))
+}
+
+// summaryWords reads the SummaryWords of config.json.
+func (blog *Blog) summaryWords() (int, error) {
+	w, ok := blog.Info["SummaryWords"]
+	if !ok {
+		return DEFAULT_SUMMARY_WORDS, nil
+	}
+	n, err := strconv.Atoi(w)
+	if err != nil || n < 1 {
+		return 0, errors.New("Bad value for SummaryWords defined in config.json")
+	}
+	return n, nil
+}
+
+// GetFeedContent returns the content of a post for the feeds: its
+// summary when FeedContent is "summary" in config.json and the whole
+// post otherwise.
+func (blog *Blog) GetFeedContent(a *Article) string {
+	if blog.Info["FeedContent"] == "summary" {
+		return a.Summary
+	}
+	return blog.GetHTMLContent(a)
+}
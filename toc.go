@@ -0,0 +1,161 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+ Table of contents. Every heading of a post gets an id and the TOC of
+ the post is a nested list of links to them, down to the TOCDepth
+ level of config.json. A [TOC] line in the source is replaced by it.
+*/
+
+const DEFAULT_TOC_DEPTH = 3
+
+var (
+	headingReg   = regexp.MustCompile(`(?s)<h([1-6])([^>]*)>(.*?)</h[1-6]>`)
+	headingIdReg = regexp.MustCompile(`\bid="([^"]*)"`)
+	tocMarkerReg = regexp.MustCompile(`(?m)^[ \t]*\[TOC\][ \t]*$`)
+	tocHTMLReg   = regexp.MustCompile(`<p>\[TOC\]</p>\n?`)
+	tocDivReg    = regexp.MustCompile(`(?s)<div class="toc">.*?</div>\n?`)
+)
+
+type tocHeading struct {
+	level int
+	id    string
+	text  string
+}
+
+func loadTOCDepth(info BlogInfo) (int, error) {
+	d, ok := info["TOCDepth"]
+	if !ok {
+		return DEFAULT_TOC_DEPTH, nil
+	}
+	depth, err := strconv.Atoi(d)
+	if err != nil || depth < 1 || depth > 6 {
+		return DEFAULT_TOC_DEPTH, errors.New("Bad value for TOCDepth defined in config.json")
+	}
+	return depth, nil
+}
+
+// headingId returns the id of a heading from its text, like "Mi
+// sección" for mi-sección.
+func headingId(text string) string {
+	id := make([]rune, 0, len(text))
+	dash := false
+	for _, c := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			if dash && len(id) > 0 {
+				id = append(id, '-')
+			}
+			id = append(id, c)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+	if len(id) == 0 {
+		return "section"
+	}
+	return string(id)
+}
+
+// addTOC sets an id to every heading of the content without one and
+// returns the content and its TOC. The [TOC] marker of the content is
+// replaced by the TOC.
+func addTOC(content string, depth int) (string, string) {
+	headings := make([]tocHeading, 0)
+	used := make(map[string]bool)
+	for _, m := range headingIdReg.FindAllStringSubmatch(content, -1) {
+		used[m[1]] = true
+	}
+
+	content = headingReg.ReplaceAllStringFunc(content, func(h string) string {
+		m := headingReg.FindStringSubmatch(h)
+		level, _ := strconv.Atoi(m[1])
+		text := htmlText(m[3])
+		if id := headingIdReg.FindStringSubmatch(m[2]); id != nil {
+			headings = append(headings, tocHeading{level, id[1], text})
+			return h
+		}
+
+		id := headingId(text)
+		for n := 1; used[id]; n++ {
+			id = fmt.Sprintf("%s-%d", headingId(text), n)
+		}
+		used[id] = true
+		headings = append(headings, tocHeading{level, id, text})
+		return fmt.Sprintf("<h%s%s id=\"%s\">%s</h%s>", m[1], m[2], id, m[3], m[1])
+	})
+
+	toc := makeTOC(headings, depth)
+	if toc == "" {
+		return tocHTMLReg.ReplaceAllString(content, ""), ""
+	}
+	return tocHTMLReg.ReplaceAllString(content, "<div class=\"toc\">\n"+toc+"</div>\n"), toc
+}
+
+// makeTOC returns the nested lists of the headings, from the highest
+// level of the post down to depth levels.
+func makeTOC(headings []tocHeading, depth int) string {
+	if len(headings) == 0 {
+		return ""
+	}
+	top := 6
+	for _, h := range headings {
+		if h.level < top {
+			top = h.level
+		}
+	}
+
+	var b strings.Builder
+	current := top - 1
+	for _, h := range headings {
+		if h.level >= top+depth {
+			continue
+		}
+		switch {
+		case h.level > current:
+			for ; current < h.level; current++ {
+				b.WriteString("<ul>\n<li>")
+			}
+		default:
+			for ; current > h.level; current-- {
+				b.WriteString("</li>\n</ul>\n")
+			}
+			b.WriteString("</li>\n<li>")
+		}
+		fmt.Fprintf(&b, "<a href=\"#%s\">%s</a>", h.id, html.EscapeString(h.text))
+	}
+	for ; current >= top; current-- {
+		b.WriteString("</li>\n</ul>\n")
+	}
+	return b.String()
+}
@@ -1,58 +1,232 @@
 package main
 
 import (
-	"fmt"
+	"encoding/json"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-type WebSockServer struct {
-	dataBuf chan []byte
-	conn    *websocket.Conn
+/*
+ WebSocket hub of the live preview. Every browser is a client of the
+ hub, which sends them the messages of the preview server. The hub is
+ an http.Handler, so it can be served by any HTTP server.
+*/
+
+// The types of the messages
+const (
+	MsgReload   = "reload"         // reload the page
+	MsgCSS      = "css"            // swap the stylesheet in Path
+	MsgError    = "error"          // show the build error in Text
+	MsgProgress = "build-progress" // a build is running, Text says what
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	wsSendQueue  = 16
+)
+
+// Message is a message of the hub to the browsers, sent as JSON.
+type Message struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type Hub struct {
+	register   chan *wsClient
+	unregister chan *wsClient
+	broadcast  chan Message
+	count      chan chan int
+	done       chan struct{}
+
+	// only used by run
+	clients map[*wsClient]bool
+	last    *Message // the last build error, sent to the new clients
+}
+
+type wsClient struct {
+	hub  *Hub
+	conn *websocket.Conn
+	send chan []byte
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     sameOrigin,
 }
 
-func NewWebSockServer() *WebSockServer {
+// sameOrigin accepts the pages of the preview server and the clients
+// that are not browsers, which send no Origin.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
 
-	ws := new(WebSockServer)
-	ws.dataBuf = make(chan []byte, 5)
+func NewHub() *Hub {
+	h := &Hub{
+		register:   make(chan *wsClient),
+		unregister: make(chan *wsClient),
+		broadcast:  make(chan Message),
+		count:      make(chan chan int),
+		done:       make(chan struct{}),
+		clients:    make(map[*wsClient]bool),
+	}
+	go h.run()
+	return h
+}
 
-	// sender thread to send msg to a client
-	go func() {
-		for {
-			msg := <-ws.dataBuf
-			if ws.conn == nil {
-				fmt.Println("Nothing to reload\n")
-				continue
+// run owns the clients of the hub: they are only added, removed and
+// written from here.
+func (h *Hub) run() {
+	for {
+		select {
+		case c := <-h.register:
+			h.clients[c] = true
+			if h.last != nil {
+				h.deliver(c, *h.last)
+			}
+		case c := <-h.unregister:
+			h.remove(c)
+		case msg := <-h.broadcast:
+			switch msg.Type {
+			case MsgError:
+				h.last = &msg
+			case MsgReload, MsgCSS:
+				h.last = nil
+			}
+			for c := range h.clients {
+				h.deliver(c, msg)
 			}
-			//if err := conn.WriteMessage(1, []byte("reload")); err != nil {
-			if err := ws.conn.WriteMessage(1, msg); err != nil {
-				fmt.Println(err)
+		case n := <-h.count:
+			n <- len(h.clients)
+		case <-h.done:
+			for c := range h.clients {
+				h.remove(c)
 			}
+			return
 		}
-	}()
+	}
+}
+
+// deliver queues a message for a client. Clients too slow to take it
+// are dropped.
+func (h *Hub) deliver(c *wsClient, msg Message) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- b:
+	default:
+		h.remove(c)
+	}
+}
 
-	return ws
+func (h *Hub) remove(c *wsClient) {
+	if h.clients[c] {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
 
+// Send sends a message to every client.
+func (h *Hub) Send(msg Message) {
+	select {
+	case h.broadcast <- msg:
+	case <-h.done:
+	}
 }
 
-func (ws *WebSockServer) WSHandler(w http.ResponseWriter, r *http.Request) {
-	var err error
-	if r.Header.Get("Origin") != "http://"+r.Host {
-		http.Error(w, "Origin not allowed", 403)
-		return
+// Clients returns the number of connected clients.
+func (h *Hub) Clients() int {
+	n := make(chan int, 1)
+	select {
+	case h.count <- n:
+		return <-n
+	case <-h.done:
+		return 0
 	}
-	fmt.Println("new ws conn\n")
-	ws.conn, err = websocket.Upgrade(w, r, w.Header(), 1024, 1024)
+}
+
+// Close disconnects every client and stops the hub.
+func (h *Hub) Close() {
+	close(h.done)
+}
+
+// ServeHTTP upgrades the request to a WebSocket and adds it to the hub.
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		http.Error(w, "Could not open websocket connection", http.StatusBadRequest)
+		// the upgrader has already answered the request
+		return
 	}
+	c := &wsClient{hub: h, conn: conn, send: make(chan []byte, wsSendQueue)}
+	select {
+	case h.register <- c:
+	case <-h.done:
+		conn.Close()
+		return
+	}
+	go c.writePump()
+	go c.readPump()
+}
 
-	if err = ws.conn.WriteMessage(1, []byte("welcome")); err != nil {
-		fmt.Println(err)
+// readPump reads the connection until it fails, to get the pongs and
+// to know when the browser goes away.
+func (c *wsClient) readPump() {
+	defer func() {
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.done:
+		}
+		c.conn.Close()
+	}()
+	c.conn.SetReadLimit(512)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
 	}
 }
 
-func (ws *WebSockServer) Send(msg []byte) {
-	ws.dataBuf <- msg
+// writePump writes the messages of the client and pings it.
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				// removed by the hub
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
 }
@@ -0,0 +1,141 @@
+/**
+
+  Grom
+
+  Copyright 2013 Sergio de Mingo
+
+  Licensed under the Apache License, Version 2.0 (the "License");
+  you may not use this file except in compliance with the License.
+  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+  Unless required by applicable law or agreed to in writing, software
+  distributed under the License is distributed on an "AS IS" BASIS,
+  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+  See the License for the specific language governing permissions and
+  limitations under the License.
+
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialHub(t *testing.T, s *httptest.Server) *websocket.Conn {
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func readMessage(t *testing.T, c *websocket.Conn) Message {
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, b, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg Message
+	if err = json.Unmarshal(b, &msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// waitClients waits until the hub has n clients.
+func waitClients(t *testing.T, h *Hub, n int) {
+	for i := 0; i < 500; i++ {
+		if h.Clients() == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("the hub has %d clients, want %d", h.Clients(), n)
+}
+
+func TestHubBroadcast(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+	s := httptest.NewServer(hub)
+	defer s.Close()
+
+	a, b := dialHub(t, s), dialHub(t, s)
+	defer a.Close()
+	defer b.Close()
+	waitClients(t, hub, 2)
+
+	hub.Send(Message{Type: MsgCSS, Path: "/themes/default/default.css"})
+	for _, c := range []*websocket.Conn{a, b} {
+		msg := readMessage(t, c)
+		if msg.Type != MsgCSS || msg.Path != "/themes/default/default.css" {
+			t.Errorf("got %+v", msg)
+		}
+	}
+}
+
+func TestHubRemovesClosedClients(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+	s := httptest.NewServer(hub)
+	defer s.Close()
+
+	a, b := dialHub(t, s), dialHub(t, s)
+	defer b.Close()
+	waitClients(t, hub, 2)
+
+	a.Close()
+	waitClients(t, hub, 1)
+
+	hub.Send(Message{Type: MsgReload})
+	if msg := readMessage(t, b); msg.Type != MsgReload {
+		t.Errorf("got %+v", msg)
+	}
+}
+
+func TestHubLastError(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+	s := httptest.NewServer(hub)
+	defer s.Close()
+
+	hub.Send(Message{Type: MsgError, Text: "Error parsing post/a.md"})
+	late := dialHub(t, s)
+	defer late.Close()
+	if msg := readMessage(t, late); msg.Type != MsgError || msg.Text != "Error parsing post/a.md" {
+		t.Errorf("got %+v", msg)
+	}
+
+	// a good build clears the error
+	hub.Send(Message{Type: MsgReload})
+	readMessage(t, late)
+	c := dialHub(t, s)
+	defer c.Close()
+	waitClients(t, hub, 2)
+	hub.Send(Message{Type: MsgProgress, Text: "Building the blog"})
+	if msg := readMessage(t, c); msg.Type != MsgProgress {
+		t.Errorf("got %+v, want no error", msg)
+	}
+}
+
+func TestHubOrigin(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+	s := httptest.NewServer(hub)
+	defer s.Close()
+
+	h := http.Header{"Origin": {"http://example.com"}}
+	_, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), h)
+	if err == nil {
+		t.Error("a page of another site could connect")
+	}
+}